@@ -0,0 +1,177 @@
+package zdb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	reArrayBefore = regexp.MustCompile(`(?i)\b(not\s+)?in\s*\(\s*$`)
+	reArrayAfter  = regexp.MustCompile(`^\s*\)`)
+)
+
+// bindArray replaces "in (?)" for the nth parameter with a version that accepts
+// a single array parameter for the driver, and converts the slice to a
+// parameter the driver understands.
+//
+// Returns false if the parameter isn't a slice or isn't used as "in (?)".
+func bindArray(d DriverType, query string, pos []int, n int, param interface{}) (string, interface{}, bool, error) {
+	if !isArrayParam(param) {
+		return query, param, false, nil
+	}
+
+	if n >= len(pos) {
+		return "", nil, false, fmt.Errorf("not enough parameters")
+	}
+	i := pos[n]
+	before := reArrayBefore.FindStringSubmatchIndex(query[:i])
+	after := reArrayAfter.FindStringIndex(query[i+1:])
+	if before == nil || after == nil {
+		return query, param, false, nil
+	}
+	var (
+		not   = before[2] > -1
+		start = before[0]
+		end   = i + 1 + after[1]
+	)
+	// Replace "in (?)" and update the offsets of this and later placeholders.
+	bind := func(repl string) string {
+		q := splice(query, pos, start, end, repl)
+		pos[n] = start + strings.IndexByte(repl, '?')
+		return q
+	}
+
+	vals, isInt, err := arrayValues(param)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	var repl string
+	switch d {
+	case DriverPostgreSQL:
+		repl = "= any(?)"
+		if not {
+			repl = "<> all(?)"
+		}
+		if isInt {
+			ints := make([]int64, 0, len(vals))
+			for _, v := range vals {
+				ints = append(ints, v.(int64))
+			}
+			return bind(repl), pq.Array(ints), true, nil
+		}
+		strs := make([]string, 0, len(vals))
+		for _, v := range vals {
+			strs = append(strs, v.(string))
+		}
+		return bind(repl), pq.Array(strs), true, nil
+
+	case DriverSQLite:
+		repl = "in (select value from json_each(?))"
+	case DriverMariaDB:
+		typ := "text"
+		if isInt {
+			typ = "bigint"
+		}
+		repl = "in (select zdb_arr.v from json_table(?, '$[*]' columns (v " + typ + " path '$')) as zdb_arr)"
+	default:
+		return query, param, false, nil
+	}
+	if not {
+		repl = "not " + repl
+	}
+
+	j, err := json.Marshal(vals)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return bind(repl), string(j), true, nil
+}
+
+func isArrayParam(param interface{}) bool {
+	if param == nil {
+		return false
+	}
+	if _, ok := param.(driver.Valuer); ok {
+		return false
+	}
+	t := reflect.TypeOf(param)
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// arrayValues converts all elements of the slice to int64 or string; isInt is
+// true if all elements are integers.
+//
+// Elements implementing driver.Valuer (such as UUID types) use the result of
+// Value().
+func arrayValues(param interface{}) ([]interface{}, bool, error) {
+	v := reflect.ValueOf(param)
+	vals := make([]interface{}, 0, v.Len())
+	isInt := true
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if val, ok := e.Interface().(driver.Valuer); ok {
+			dv, err := val.Value()
+			if err != nil {
+				return nil, false, err
+			}
+			e = reflect.ValueOf(dv)
+			if !e.IsValid() {
+				return nil, false, fmt.Errorf("NULL value in array at index %d", i)
+			}
+		}
+
+		switch e.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			vals = append(vals, e.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u := e.Uint()
+			if u > math.MaxInt64 {
+				return nil, false, fmt.Errorf("value %d at index %d overflows int64", u, i)
+			}
+			vals = append(vals, int64(u))
+		case reflect.String:
+			isInt = false
+			vals = append(vals, e.String())
+		case reflect.Slice:
+			if b, ok := e.Interface().([]byte); ok {
+				isInt = false
+				vals = append(vals, string(b))
+				continue
+			}
+			return nil, false, fmt.Errorf("unsupported array element type %s", e.Type())
+		default:
+			if s, ok := e.Interface().(fmt.Stringer); ok {
+				isInt = false
+				vals = append(vals, s.String())
+				continue
+			}
+			return nil, false, fmt.Errorf("unsupported array element type %s", e.Type())
+		}
+	}
+
+	// Always convert to strings if there's a mix.
+	if !isInt {
+		for i := range vals {
+			if n, ok := vals[i].(int64); ok {
+				vals[i] = fmt.Sprintf("%d", n)
+			}
+		}
+	}
+	if len(vals) == 0 {
+		switch v.Type().Elem().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return vals, true, nil
+		}
+		return vals, false, nil
+	}
+	return vals, isInt, nil
+}
@@ -0,0 +1,111 @@
+package zdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testUUID [2]byte
+
+func (u testUUID) String() string { return fmt.Sprintf("%02x-%02x", u[0], u[1]) }
+
+func TestBindArrays(t *testing.T) {
+	if ctx := StartTest(t); Driver(ctx) == DriverSQLite && Exec(ctx, `select json('[]')`) != nil {
+		t.Skip("SQLite JSON1 extension not available; use -tags=sqlite_json")
+	}
+	ctx := StartTest(t, ConnectOptions{BindArrays: true})
+
+	err := Exec(ctx, `
+		create table t (i int, s varchar(255));
+		insert into t values (1, 'a'), (2, 'b'), (3, '01-02'), (4, 'd');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query  string
+		params []interface{}
+		want   []int
+	}{
+		{`select i from t where i in (:x) order by i`, L{P{"x": []int{1, 3}}}, []int{1, 3}},
+		{`select i from t where i in (?) order by i`, L{[]int64{2}}, []int{2}},
+		{`select i from t where i not in (:x) order by i`, L{P{"x": []int{1, 3}}}, []int{2, 4}},
+		{`select i from t where i in (:x) order by i`, L{P{"x": []int{}}}, nil},
+		{`select i from t where s in (:x) order by i`, L{P{"x": []string{"a", "d"}}}, []int{1, 4}},
+		{`select i from t where s IN ( :x ) order by i`, L{P{"x": []string{"b"}}}, []int{2}},
+		{`select i from t where s in (:x) order by i`, L{P{"x": []testUUID{{1, 2}}}}, []int{3}},
+		{`select i from t where s <> '?' and i in (:x) order by i`, L{P{"x": []int{1, 3}}}, []int{1, 3}},
+		{`select i from t where s <> '?' and i in (?) and s <> ? order by i`, L{[]int64{1, 3}, "a"}, []int{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var have []int
+			err := Select(ctx, &have, tt.query, tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %v\nwant: %v", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("query", func(t *testing.T) {
+		query, params, err := Prepare(ctx, `select i from t where i in (:x) and s in (:y)`,
+			P{"x": []int{1, 2}, "y": []string{"a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		have := fmt.Sprintf("%s %v", query, params)
+		want := map[DriverType]string{
+			DriverSQLite:     `select i from t where i in (select value from json_each(?)) and s in (select value from json_each(?)) [[1,2] ["a"]]`,
+			DriverPostgreSQL: `select i from t where i = any($1) and s = any($2) {1,2} {"a"}`,
+			DriverMariaDB: `select i from t where i in (select zdb_arr.v from json_table(?, '$[*]' columns (v bigint path '$')) as zdb_arr) and ` +
+				`s in (select zdb_arr.v from json_table(?, '$[*]' columns (v text path '$')) as zdb_arr) [[1,2] ["a"]]`,
+		}[Driver(ctx)]
+		if Driver(ctx) == DriverPostgreSQL {
+			have = query
+			for _, p := range params {
+				v, _ := p.(driver.Valuer).Value()
+				have += fmt.Sprintf(" %s", v)
+			}
+		}
+		if have != want {
+			t.Errorf("\nhave: %s\nwant: %s", have, want)
+		}
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		// Slices not in "in (..)" are still expanded.
+		query, params, err := Prepare(ctx, `insert into t values (:x)`, P{"x": []string{"a", "b"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := MustGetDB(ctx).Rebind(`insert into t values (?, ?)`); query != want {
+			t.Errorf("wrong query: %s", query)
+		}
+		if !reflect.DeepEqual(params, []interface{}{"a", "b"}) {
+			t.Errorf("wrong params: %#v", params)
+		}
+	})
+}
+
+func TestArrayValues(t *testing.T) {
+	have, isInt, err := arrayValues([]uint64{1, math.MaxInt64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isInt || fmt.Sprint(have) != "[1 9223372036854775807]" {
+		t.Errorf("%v %v", have, isInt)
+	}
+
+	_, _, err = arrayValues([]uint64{1, math.MaxInt64 + 1})
+	if err == nil || !strings.Contains(err.Error(), "overflows int64") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
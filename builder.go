@@ -0,0 +1,355 @@
+package zdb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SelectBuilder builds a select query.
+//
+// The query and parameters from SQL() can be passed to Prepare(), Select(),
+// Get(), etc:
+//
+//   query, params, err := zdb.NewSelect("id", "email").
+//       From("users").
+//       Where("site_id = ?", site).
+//       Where("created_at > ?", since).
+//       OrderBy("created_at desc").
+//       Limit(10).
+//       SQL(zdb.Driver(ctx))
+//   if err != nil {
+//       return err
+//   }
+//   err = zdb.Select(ctx, &users, query, params...)
+//
+// Column and table names that are plain identifiers ("col" or "tbl.col") are
+// quoted for the driver; anything else (such as "count(*) as n") is added
+// as-is. Never use user input for these; use parameters or Ident for that.
+// Names are folded to lower case on PostgreSQL first, so they refer to the same
+// thing as without quotes.
+//
+// A *SelectBuilder can be used as a parameter in Where() to add a sub-query;
+// its parameters are merged with the parent's.
+type SelectBuilder struct {
+	cols    []string
+	from    []fromClause
+	joins   []joinClause
+	where   []whereClause
+	groupBy []string
+	having  []whereClause
+	orderBy []string
+	limit   int
+	offset  int
+}
+
+type (
+	fromClause struct {
+		table string
+		sub   *SelectBuilder
+		alias string
+	}
+	joinClause struct {
+		kind, table, on string
+	}
+	whereClause struct {
+		cond   string
+		params []interface{}
+	}
+)
+
+// NewSelect makes a new SelectBuilder for the given columns.
+func NewSelect(cols ...string) *SelectBuilder {
+	return &SelectBuilder{cols: cols}
+}
+
+// From adds tables to select from.
+func (b *SelectBuilder) From(tables ...string) *SelectBuilder {
+	for _, t := range tables {
+		b.from = append(b.from, fromClause{table: t})
+	}
+	return b
+}
+
+// FromSub adds a sub-query to select from.
+func (b *SelectBuilder) FromSub(sub *SelectBuilder, alias string) *SelectBuilder {
+	b.from = append(b.from, fromClause{sub: sub, alias: alias})
+	return b
+}
+
+// Join adds "join table on [..]"; the on clause is added as-is.
+func (b *SelectBuilder) Join(table, on string) *SelectBuilder {
+	b.joins = append(b.joins, joinClause{kind: "join", table: table, on: on})
+	return b
+}
+
+// LeftJoin adds "left join table on [..]"; the on clause is added as-is.
+func (b *SelectBuilder) LeftJoin(table, on string) *SelectBuilder {
+	b.joins = append(b.joins, joinClause{kind: "left join", table: table, on: on})
+	return b
+}
+
+// Where adds a condition, using ? placeholders for the parameters. Multiple
+// conditions are combined with "and".
+func (b *SelectBuilder) Where(cond string, params ...interface{}) *SelectBuilder {
+	b.where = append(b.where, whereClause{cond: cond, params: params})
+	return b
+}
+
+// GroupBy adds columns to group by.
+func (b *SelectBuilder) GroupBy(cols ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, cols...)
+	return b
+}
+
+// Having adds a "having" condition; see Where().
+func (b *SelectBuilder) Having(cond string, params ...interface{}) *SelectBuilder {
+	b.having = append(b.having, whereClause{cond: cond, params: params})
+	return b
+}
+
+// OrderBy adds columns to order by; these can end with " asc" or " desc".
+func (b *SelectBuilder) OrderBy(cols ...string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, cols...)
+	return b
+}
+
+// Limit sets the limit; 0 means no limit.
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// Offset sets the offset.
+func (b *SelectBuilder) Offset(n int) *SelectBuilder {
+	b.offset = n
+	return b
+}
+
+// SQL gets the query and parameters for the driver.
+func (b *SelectBuilder) SQL(driver DriverType) (string, []interface{}, error) {
+	query, params, err := b.build(driver)
+	if err != nil {
+		return "", nil, fmt.Errorf("zdb.SelectBuilder: %w", err)
+	}
+	return query, params, nil
+}
+
+func (b *SelectBuilder) build(driver DriverType) (string, []interface{}, error) {
+	if len(b.cols) == 0 {
+		return "", nil, fmt.Errorf("no columns")
+	}
+
+	var (
+		q      strings.Builder
+		params []interface{}
+	)
+	q.WriteString("select ")
+	for i, c := range b.cols {
+		if i > 0 {
+			q.WriteString(", ")
+		}
+		q.WriteString(quoteIfIdent(driver, c))
+	}
+
+	if len(b.from) > 0 {
+		q.WriteString(" from ")
+		for i, f := range b.from {
+			if i > 0 {
+				q.WriteString(", ")
+			}
+			if f.sub == nil {
+				q.WriteString(quoteIfIdent(driver, f.table))
+				continue
+			}
+			sub, subParams, err := f.sub.build(driver)
+			if err != nil {
+				return "", nil, err
+			}
+			q.WriteString("(" + sub + ") as " + quoteIdent(driver, foldIdent(driver, f.alias)))
+			params = append(params, subParams...)
+		}
+	}
+
+	for _, j := range b.joins {
+		q.WriteString(" " + j.kind + " " + quoteIfIdent(driver, j.table) + " on " + j.on)
+	}
+
+	where, whereParams, err := buildConds(driver, b.where)
+	if err != nil {
+		return "", nil, err
+	}
+	if where != "" {
+		q.WriteString(" where " + where)
+		params = append(params, whereParams...)
+	}
+
+	if len(b.groupBy) > 0 {
+		q.WriteString(" group by ")
+		for i, c := range b.groupBy {
+			if i > 0 {
+				q.WriteString(", ")
+			}
+			q.WriteString(quoteIfIdent(driver, c))
+		}
+	}
+
+	having, havingParams, err := buildConds(driver, b.having)
+	if err != nil {
+		return "", nil, err
+	}
+	if having != "" {
+		q.WriteString(" having " + having)
+		params = append(params, havingParams...)
+	}
+
+	if len(b.orderBy) > 0 {
+		q.WriteString(" order by ")
+		for i, c := range b.orderBy {
+			if i > 0 {
+				q.WriteString(", ")
+			}
+			q.WriteString(quoteOrder(driver, c))
+		}
+	}
+
+	if b.limit > 0 {
+		q.WriteString(" limit " + strconv.Itoa(b.limit))
+	} else if b.offset > 0 {
+		// SQLite and MariaDB don't allow an offset without a limit.
+		switch driver {
+		case DriverSQLite:
+			q.WriteString(" limit -1")
+		case DriverMariaDB:
+			q.WriteString(" limit 18446744073709551615")
+		}
+	}
+	if b.offset > 0 {
+		q.WriteString(" offset " + strconv.Itoa(b.offset))
+	}
+
+	return q.String(), params, nil
+}
+
+// Combine conditions with "and", replacing sub-query parameters.
+func buildConds(driver DriverType, conds []whereClause) (string, []interface{}, error) {
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+
+	var (
+		parts  = make([]string, 0, len(conds))
+		params []interface{}
+	)
+	for _, c := range conds {
+		if n := strings.Count(c.cond, "?"); n != len(c.params) {
+			return "", nil, fmt.Errorf("%q: wrong number of parameters: %d placeholders and %d parameters",
+				c.cond, n, len(c.params))
+		}
+
+		cond := c.cond
+		pos := 0
+		for _, p := range c.params {
+			i := strings.IndexByte(cond[pos:], '?') + pos
+			sub, ok := p.(*SelectBuilder)
+			if !ok {
+				params = append(params, p)
+				pos = i + 1
+				continue
+			}
+
+			subQuery, subParams, err := sub.build(driver)
+			if err != nil {
+				return "", nil, err
+			}
+			subQuery = "(" + subQuery + ")"
+			// Don't add double parens for "in (?)".
+			if strings.HasSuffix(cond[:i], "(") && strings.HasPrefix(cond[i+1:], ")") {
+				subQuery = subQuery[1 : len(subQuery)-1]
+			}
+			cond = cond[:i] + subQuery + cond[i+1:]
+			params = append(params, subParams...)
+			pos = i + len(subQuery)
+		}
+
+		if len(conds) == 1 {
+			parts = append(parts, cond)
+		} else {
+			parts = append(parts, "("+cond+")")
+		}
+	}
+	return strings.Join(parts, " and "), params, nil
+}
+
+var reIdent = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+
+// Quote s if it's a plain identifier, optionally with a table or schema
+// prefix ("tbl.col"); anything else is returned as-is.
+func quoteIfIdent(driver DriverType, s string) string {
+	s = strings.TrimSpace(s)
+	if !reIdent.MatchString(s) {
+		return s
+	}
+	return quoteIdent(driver, strings.Split(foldIdent(driver, s), ".")...)
+}
+
+// PostgreSQL folds unquoted identifiers to lower case, but quoted identifiers
+// are case-sensitive; fold it here so that quoting doesn't change which column
+// or table "userID" refers to.
+func foldIdent(driver DriverType, s string) string {
+	if driver == DriverPostgreSQL {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// Quote an order by column, which can end with asc or desc.
+func quoteOrder(driver DriverType, s string) string {
+	s = strings.TrimSpace(s)
+	for _, dir := range []string{" asc", " desc", " ASC", " DESC"} {
+		if strings.HasSuffix(s, dir) {
+			return quoteIfIdent(driver, s[:len(s)-len(dir)]) + dir
+		}
+	}
+	return quoteIfIdent(driver, s)
+}
+
+// Validate and quote the identifier for the driver.
+func (id Identifier) quote(driver DriverType) (string, error) {
+	if len(id) == 0 {
+		return "", errors.New("zdb.Ident: no identifier")
+	}
+	max := 0
+	switch driver {
+	case DriverPostgreSQL:
+		max = 63
+	case DriverMariaDB:
+		max = 64
+	}
+	for _, p := range id {
+		switch {
+		case p == "":
+			return "", fmt.Errorf("zdb.Ident: empty identifier in %q", []string(id))
+		case strings.ContainsRune(p, 0):
+			return "", fmt.Errorf("zdb.Ident: NUL byte in identifier %q", p)
+		case max > 0 && len(p) > max:
+			return "", fmt.Errorf("zdb.Ident: identifier %q longer than %d bytes", p, max)
+		}
+	}
+	return quoteIdent(driver, id...), nil
+}
+
+// Quote identifier parts for the driver and join them with ".".
+func quoteIdent(driver DriverType, parts ...string) string {
+	q := `"`
+	if driver == DriverMariaDB {
+		q = "`"
+	}
+	quoted := make([]string, 0, len(parts))
+	for _, p := range parts {
+		quoted = append(quoted, q+strings.ReplaceAll(p, q, q+q)+q)
+	}
+	return strings.Join(quoted, ".")
+}
@@ -0,0 +1,140 @@
+package zdb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"zgo.at/zstd/ztest"
+)
+
+func TestSelectBuilder(t *testing.T) {
+	tests := []struct {
+		b          *SelectBuilder
+		driver     DriverType
+		wantQuery  string
+		wantParams []interface{}
+		wantErr    string
+	}{
+		{NewSelect("id", "t.email", "count(*) as n").From("users as t"), DriverPostgreSQL,
+			`select "id", "t"."email", count(*) as n from users as t`, nil, ""},
+		{NewSelect("id").From("users"), DriverMariaDB,
+			"select `id` from `users`", nil, ""},
+		{NewSelect("id").From("users").Where("a = ?", 1), DriverSQLite,
+			`select "id" from "users" where a = ?`, L{1}, ""},
+		{NewSelect("id").From("users").Where("a = ?", 1).Where("b = ? or c = ?", 2, 3), DriverSQLite,
+			`select "id" from "users" where (a = ?) and (b = ? or c = ?)`, L{1, 2, 3}, ""},
+		{NewSelect("id").From("users").OrderBy("id desc", "email", "lower(x) asc").Limit(10).Offset(5), DriverSQLite,
+			`select "id" from "users" order by "id" desc, "email", lower(x) asc limit 10 offset 5`, nil, ""},
+		{NewSelect("id").From("users").Offset(5), DriverSQLite,
+			`select "id" from "users" limit -1 offset 5`, nil, ""},
+		{NewSelect("id").From("users").Offset(5), DriverMariaDB,
+			"select `id` from `users` limit 18446744073709551615 offset 5", nil, ""},
+		{NewSelect("id").From("users").Offset(5), DriverPostgreSQL,
+			`select "id" from "users" offset 5`, nil, ""},
+		{NewSelect("userID", "U.siteID").From("Users as U").OrderBy("userID desc"), DriverPostgreSQL,
+			`select "userid", "u"."siteid" from Users as U order by "userid" desc`, nil, ""},
+		{NewSelect("userID").From("Users").OrderBy("userID desc"), DriverSQLite,
+			`select "userID" from "Users" order by "userID" desc`, nil, ""},
+		{NewSelect("site", "count(*)").From("users").GroupBy("site").Having("count(*) > ?", 2), DriverSQLite,
+			`select "site", count(*) from "users" group by "site" having count(*) > ?`, L{2}, ""},
+		{NewSelect("u.id").From("users u").Join("sites", "sites.id = u.site").LeftJoin("x", "x.id = u.x"), DriverSQLite,
+			`select "u"."id" from users u join "sites" on sites.id = u.site left join "x" on x.id = u.x`, nil, ""},
+
+		// Sub-queries
+		{NewSelect("id").From("users").
+			Where("a = ?", 1).
+			Where("site in (?) and b = ?", NewSelect("id").From("sites").Where("c = ?", 2), 3), DriverSQLite,
+			`select "id" from "users" where (a = ?) and (site in (select "id" from "sites" where c = ?) and b = ?)`, L{1, 2, 3}, ""},
+		{NewSelect("id").From("users").Where("exists ?", NewSelect("1").From("sites")), DriverSQLite,
+			`select "id" from "users" where exists (select 1 from "sites")`, nil, ""},
+		{NewSelect("x.id").FromSub(NewSelect("id").From("users").Where("a = ?", 1), "x").Where("b = ?", 2), DriverPostgreSQL,
+			`select "x"."id" from (select "id" from "users" where a = ?) as "x" where b = ?`, L{1, 2}, ""},
+
+		// Identifiers are passed on to Prepare()
+		{NewSelect("id").From("users").Where("? = 1", Ident("a")), DriverSQLite,
+			`select "id" from "users" where ? = 1`, L{Identifier{"a"}}, ""},
+		{NewSelect("id").From(`x"y`, "s.t").OrderBy("id"), DriverMariaDB,
+			"select `id` from x\"y, `s`.`t` order by `id`", nil, ""},
+
+		// Errors
+		{NewSelect(), DriverSQLite, "", nil, "no columns"},
+		{NewSelect("id").Where("a = ?"), DriverSQLite, "", nil, "1 placeholders and 0 parameters"},
+		{NewSelect("id").Where("a = ?", NewSelect()), DriverSQLite, "", nil, "no columns"},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			query, params, err := tt.b.SQL(tt.driver)
+			if !ztest.ErrorContains(err, tt.wantErr) {
+				t.Fatal(err)
+			}
+			if query != tt.wantQuery {
+				t.Errorf("wrong query\nhave: %s\nwant: %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("wrong params\nhave: %#v\nwant: %#v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestSelectBuilderQuery(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `
+		create table users (id int, site int, email varchar(255));
+		insert into users values (1, 1, 'a'), (2, 1, 'b'), (3, 2, 'c');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, params, err := NewSelect("email").
+		From("users").
+		Where("site = ?", 1).
+		OrderBy("id desc").
+		SQL(Driver(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var emails []string
+	err = Select(ctx, &emails, query, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := fmt.Sprintf("%v", emails); have != "[b a]" {
+		t.Error(have)
+	}
+	// Offset without a limit.
+	query, params, err = NewSelect("email").From("users").OrderBy("id").Offset(1).SQL(Driver(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails = nil
+	err = Select(ctx, &emails, query, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := fmt.Sprintf("%v", emails); have != "[b c]" {
+		t.Error(have)
+	}
+
+	// Mixed-case names should refer to the same column as the unquoted name.
+	err = Exec(ctx, `create table userData (userID int); insert into userData values (1), (2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, params, err = NewSelect("userID").From("userData").OrderBy("userID desc").SQL(Driver(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	err = Select(ctx, &ids, query, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := fmt.Sprintf("%v", ids); have != "[2 1]" {
+		t.Error(have)
+	}
+}
@@ -2,6 +2,7 @@ package zdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -61,6 +62,11 @@ func (m *BulkInsert) doInsert() {
 	query, params := m.insert.SQL()
 	err := Exec(m.ctx, query, params...)
 	if err != nil {
+		// We already add the query and params below.
+		var qErr *QueryError
+		if errors.As(err, &qErr) {
+			err = qErr.Err
+		}
 		fmtParams := make([]interface{}, 0, len(params))
 		for _, p := range params {
 			fmtParams = append(fmtParams, formatParam(p, true))
@@ -0,0 +1,233 @@
+package zdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CheckOptions are options for NewCheckDB().
+type CheckOptions struct {
+	// Report query templates that are run more than MaxRepeat times in a
+	// single request scope (see WithRequestScope()); this usually means there
+	// is a "N+1" query in a loop. 0 disables this.
+	MaxRepeat int
+
+	// Run EXPLAIN on every distinct query, and report full table scans on
+	// tables with at least ScanRows rows. 0 disables this.
+	//
+	// Explain() actually runs the query on PostgreSQL and MariaDB, so every
+	// distinct select query is run twice there.
+	ScanRows int
+}
+
+// RecordedQuery is a query recorded by NewCheckDB().
+type RecordedQuery struct {
+	Query    string
+	Params   []interface{}
+	Took     time.Duration
+	Location string
+}
+
+// QueryRecorder has all the queries from a NewCheckDB() wrapper.
+type QueryRecorder struct {
+	mu        sync.Mutex
+	queries   []RecordedQuery
+	explained map[string]struct{}
+}
+
+// Queries gets all recorded queries.
+func (r *QueryRecorder) Queries() []RecordedQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedQuery(nil), r.queries...)
+}
+
+// Reset the list of recorded queries.
+func (r *QueryRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = nil
+}
+
+type checkDB struct {
+	DB
+	t   testing.TB
+	opt CheckOptions
+	rec *QueryRecorder
+}
+
+// NewCheckDB returns a DB wrapper for tests which records all queries, and
+// reports performance problems with t.Error():
+//
+// - Queries that are run more than CheckOptions.MaxRepeat times in a request.
+//   Queries are compared by their template: the query with all parameters and
+//   literals removed.
+//
+// - Full table scans on tables with at least CheckOptions.ScanRows rows. This
+//   runs Explain() once for every template after the query succeeded; see the
+//   notes on Explain(). Only select, insert, update, and delete queries are
+//   checked. Query() is never checked, as the rows are still being read when
+//   it returns.
+//
+// For example:
+//
+//   ctx := zdb.StartTest(t)
+//   db, rec := zdb.NewCheckDB(t, zdb.MustGetDB(ctx), zdb.CheckOptions{MaxRepeat: 5, ScanRows: 100})
+//   ctx = zdb.WithDB(ctx, db)
+//
+//   handler(w, r.WithContext(zdb.WithRequestScope(ctx)))
+func NewCheckDB(t testing.TB, db DB, opt CheckOptions) (DB, *QueryRecorder) {
+	rec := &QueryRecorder{explained: make(map[string]struct{})}
+	return &checkDB{DB: db, t: t, opt: opt, rec: rec}, rec
+}
+
+type requestScope struct {
+	mu       sync.Mutex
+	count    map[string]int
+	reported map[string]struct{}
+}
+
+var scopekey = &struct{ n string }{"zdb.requestScope"}
+
+// WithRequestScope returns a copy of the context with a new request scope, for
+// the N+1 query detection in NewCheckDB().
+//
+// Usually you want to add this in a HTTP middleware or at the start of a
+// background job; it doesn't do anything outside of NewCheckDB().
+func WithRequestScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopekey, &requestScope{
+		count:    make(map[string]int),
+		reported: make(map[string]struct{}),
+	})
+}
+
+func (d checkDB) Unwrap() DB { return d.DB }
+
+func (d checkDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
+	ctx, tx, err := d.DB.Begin(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	cdb := &checkDB{DB: tx, t: d.t, opt: d.opt, rec: d.rec}
+	return WithDB(ctx, cdb), cdb, nil
+}
+
+func (d checkDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).ExecContext(ctx, query, params...)
+	d.check(ctx, query, params, time.Since(start))
+	if err == nil {
+		d.explain(ctx, query, params)
+	}
+	return r, err
+}
+func (d checkDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
+	d.check(ctx, query, params, time.Since(start))
+	if err == nil || ErrNoRows(err) {
+		d.explain(ctx, query, params)
+	}
+	return err
+}
+func (d checkDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
+	d.check(ctx, query, params, time.Since(start))
+	if err == nil {
+		d.explain(ctx, query, params)
+	}
+	return err
+}
+func (d checkDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).QueryxContext(ctx, query, params...)
+	d.check(ctx, query, params, time.Since(start))
+	return r, err
+}
+
+func (d checkDB) check(ctx context.Context, query string, params []interface{}, took time.Duration) {
+	loc := callerLoc()
+	d.rec.mu.Lock()
+	d.rec.queries = append(d.rec.queries, RecordedQuery{
+		Query:    query,
+		Params:   params,
+		Took:     took,
+		Location: loc,
+	})
+	d.rec.mu.Unlock()
+
+	if d.opt.MaxRepeat <= 0 {
+		return
+	}
+	s, ok := ctx.Value(scopekey).(*requestScope)
+	if !ok {
+		return
+	}
+
+	tpl := normalizeQuery(query)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count[tpl]++
+	if _, ok := s.reported[tpl]; ok || s.count[tpl] <= d.opt.MaxRepeat {
+		return
+	}
+	s.reported[tpl] = struct{}{}
+	d.t.Errorf("zdb.CheckDB: query run more than %d times in one request (N+1 query?) at %s:\n%s",
+		d.opt.MaxRepeat, loc, strings.TrimSpace(query))
+}
+
+func (d checkDB) explain(ctx context.Context, query string, params []interface{}) {
+	if d.opt.ScanRows <= 0 {
+		return
+	}
+	q, ok := trimComments(query)
+	if !ok {
+		return
+	}
+	switch firstWord(q) {
+	case "select", "with", "insert", "update", "delete":
+	default:
+		return
+	}
+
+	tpl := normalizeQuery(query)
+	d.rec.mu.Lock()
+	_, ok = d.rec.explained[tpl]
+	d.rec.explained[tpl] = struct{}{}
+	d.rec.mu.Unlock()
+	if ok {
+		return
+	}
+
+	db := Unwrap(d.DB)
+	ctx = WithDB(ctx, db)
+	plan, err := Explain(ctx, query, params...)
+	if err != nil {
+		d.t.Errorf("zdb.CheckDB: %s", err)
+		return
+	}
+
+	loc := callerLoc()
+	plan.Walk(func(p *Plan, _ int) {
+		if !p.FullScan || p.Table == "" {
+			return
+		}
+		var n int
+		err := Get(ctx, &n, `select count(*) from `+quoteIdent(db.Driver(), p.Table))
+		if err != nil {
+			d.t.Errorf("zdb.CheckDB: %s", err)
+			return
+		}
+		if n >= d.opt.ScanRows {
+			d.t.Errorf("zdb.CheckDB: full table scan on %q with %d rows at %s:\n%s\n\n%s",
+				p.Table, n, loc, strings.TrimSpace(query), strings.TrimSpace(plan.String()))
+		}
+	})
+}
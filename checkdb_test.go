@@ -0,0 +1,150 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type errorsTB struct {
+	testing.TB
+	mu   sync.Mutex
+	errs []string
+}
+
+func (t *errorsTB) Errorf(f string, a ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errs = append(t.errs, fmt.Sprintf(f, a...))
+}
+
+func TestCheckDB(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table x (i int, j int); create index x_j on x(j)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err := Exec(ctx, `insert into x values (?, ?)`, i, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("repeat", func(t *testing.T) {
+		tb := &errorsTB{TB: t}
+		db, rec := NewCheckDB(tb, Unwrap(MustGetDB(ctx)), CheckOptions{MaxRepeat: 3})
+		ctx := WithRequestScope(WithDB(context.Background(), db))
+
+		for i := 0; i < 6; i++ {
+			var n int
+			err := Get(ctx, &n, `select i from x where j = ?`, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := TX(ctx, func(ctx context.Context) error {
+			for _, i := range []int{1, 2, 3} {
+				err := Exec(ctx, `update x set i = i where j = :j`, P{"j": i})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tb.errs) != 1 || !strings.Contains(tb.errs[0], "more than 3 times") || !strings.Contains(tb.errs[0], "checkdb_test.go:") {
+			t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+		}
+		if q := rec.Queries(); len(q) != 9 || normalizeQuery(q[8].Query) != "update x set i = i where j = ?" {
+			t.Errorf("wrong queries: %v", q)
+		}
+
+		// Outside of request scope.
+		tb.errs = nil
+		for i := 0; i < 6; i++ {
+			err := Exec(WithDB(context.Background(), db), `update x set i = i where j = ?`, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(tb.errs) != 0 {
+			t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+		}
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		if Driver(ctx) != DriverSQLite {
+			t.Skip("query plans on small tables are different for PostgreSQL and MariaDB")
+		}
+		tests := []struct {
+			rows     int
+			query    string
+			wantScan bool
+		}{
+			{10, `select * from x where i = 1`, true},
+			{11, `select * from x where i = 1`, false},
+			{1, `select * from x where j = 1`, false},
+			{1, `update x set i = 1 where i = 1`, true},
+			{1, `create table y (i int)`, false},
+		}
+		for _, tt := range tests {
+			t.Run("", func(t *testing.T) {
+				tb := &errorsTB{TB: t}
+				db, _ := NewCheckDB(tb, Unwrap(MustGetDB(ctx)), CheckOptions{ScanRows: tt.rows})
+				ctx := WithDB(context.Background(), db)
+
+				err := Exec(ctx, tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Only explained once.
+				if firstWord(tt.query) != "create" {
+					err = Exec(ctx, tt.query)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if tt.wantScan {
+					if len(tb.errs) != 1 || !strings.Contains(tb.errs[0], `full table scan on "x" with 10 rows`) {
+						t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+					}
+				} else if len(tb.errs) != 0 {
+					t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+				}
+			})
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		tb := &errorsTB{TB: t}
+		db, rec := NewCheckDB(tb, Unwrap(MustGetDB(ctx)), CheckOptions{ScanRows: 1})
+		ctx := WithDB(context.Background(), db)
+
+		// Not explained, as the rows are still open.
+		rows, err := Query(ctx, `select * from x where i = 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		err = rows.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tb.errs) != 0 {
+			t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+		}
+		if q := rec.Queries(); len(q) != 1 {
+			t.Errorf("wrong queries: %v", q)
+		}
+	})
+}
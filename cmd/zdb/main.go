@@ -0,0 +1,131 @@
+// Command zdb runs migrations and inspects databases for projects using zdb.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"zgo.at/zdb"
+)
+
+const usage = `zdb is a tool to work with zdb databases.
+
+Usage: zdb [flags] command [arguments]
+
+Flags:
+
+    -db        Connect string; defaults to $ZDB_CONNECT. For example:
+                   sqlite3://db.sqlite3
+                   postgresql://dbname=mydb
+                   mysql://user@unix(/var/run/mysqld/mysqld.sock)/mydb
+
+    -dir       Directory with the schema, migrations, and queries. Default: db
+
+    -create    Create the database (with the schema) if it doesn't exist.
+
+Commands:
+
+    migrate status         List all migrations and whether they've been run.
+    migrate up [name..]    Run the given migrations, or all pending ones.
+    migrate down [name]    Revert a migration, or the last one if no name is
+                           given. This requires a {name}.down.sql file.
+    migrate plan           Show the SQL of all pending migrations.
+    migrate new <name>     Create a new migration file.
+
+    schema dump            Print the current database schema.
+
+    query <name> [flags]   Run a query from the query directory, as with
+                           "load:name". Flags:
+
+                           -p key=val  Named parameter; can be repeated.
+                           -format     Output format: table (default),
+                                       vertical, csv, json, html.
+
+    check                  Load every query in the query directory for this
+                           driver, and report missing or invalid files.
+`
+
+// stdout is where the output of commands is written.
+var stdout io.Writer = os.Stdout
+
+func main() {
+	f := flag.NewFlagSet("zdb", flag.ContinueOnError)
+	f.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	var (
+		connect = f.String("db", os.Getenv("ZDB_CONNECT"), "")
+		dir     = f.String("dir", "db", "")
+		create  = f.Bool("create", false, "")
+	)
+	err := f.Parse(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+
+	args := f.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	err = run(*connect, *dir, *create, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zdb: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(connect, dir string, create bool, args []string) error {
+	// Creating a new migration file doesn't need a connection.
+	if len(args) >= 2 && args[0] == "migrate" && args[1] == "new" {
+		if len(args) != 3 {
+			return errors.New("migrate new: need exactly one name")
+		}
+		return migrateNew(dir, args[2])
+	}
+
+	if connect == "" {
+		return errors.New("need a connect string with -db or $ZDB_CONNECT")
+	}
+	files := os.DirFS(dir)
+	if _, err := fs.Stat(files, "."); err != nil {
+		return fmt.Errorf("-dir: %w", err)
+	}
+
+	db, err := zdb.Connect(zdb.ConnectOptions{
+		Connect: connect,
+		Create:  create,
+		Files:   files,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := zdb.WithDB(context.Background(), db)
+
+	switch args[0] {
+	case "migrate":
+		return cmdMigrate(ctx, files, args[1:])
+	case "schema":
+		if len(args) != 2 || args[1] != "dump" {
+			return errors.New("schema: unknown subcommand; only \"schema dump\" is supported")
+		}
+		return schemaDump(ctx, connect)
+	case "query":
+		return cmdQuery(ctx, args[1:])
+	case "check":
+		if len(args) != 1 {
+			return fmt.Errorf("check: unknown arguments: %s", args[1:])
+		}
+		return cmdCheck(ctx)
+	default:
+		return fmt.Errorf("unknown command: %q", args[0])
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "migrate"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testRun(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	defer func() { stdout = os.Stdout }()
+	stdout = buf
+	err := run("sqlite3://"+filepath.Join(dir, "db.sqlite3"), dir, true, args)
+	return buf.String(), err
+}
+
+func TestArgs(t *testing.T) {
+	dir := testDir(t, map[string]string{"schema-sqlite.sql": `create table x (i int);`})
+
+	tests := []struct {
+		connect string
+		args    []string
+		wantErr string
+	}{
+		{"", []string{"migrate", "new"}, "migrate new: need exactly one name"},
+		{"", []string{"migrate", "new", "a", "b"}, "migrate new: need exactly one name"},
+		{"", []string{"check"}, "need a connect string"},
+		{"sqlite3://:memory:", []string{"migrate"}, "migrate: need a subcommand"},
+		{"sqlite3://:memory:", []string{"migrate", "down", "a", "b"}, "can only revert one migration"},
+		{"sqlite3://:memory:", []string{"schema"}, "schema: unknown subcommand"},
+		{"sqlite3://:memory:", []string{"check", "x"}, "check: unknown arguments"},
+		{"sqlite3://:memory:", []string{"query"}, "query: need a query name"},
+		{"sqlite3://:memory:", []string{"query", "x", "-p", "k"}, "not in key=val format"},
+		{"sqlite3://:memory:", []string{"query", "x", "-format", "xml"}, "unknown -format"},
+		{"sqlite3://:memory:", []string{"nope"}, `unknown command: "nope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			err := run(tt.connect, dir, true, tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("wrong error\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaDump(t *testing.T) {
+	dir := testDir(t, map[string]string{"schema-sqlite.sql": `create table x (i int);`})
+
+	out, err := testRun(t, dir, "schema", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "CREATE TABLE x (i int);") {
+		t.Errorf("wrong output:\n%s", out)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		dir := testDir(t, map[string]string{
+			"schema-sqlite.sql":             `create table x (i int);`,
+			"query/select-x.sql":            `select * from x`,
+			"query/select-x_test.sql":       `-- params`,
+			"query/only-postgres.sql":       `select 1::int`,
+			"query/for-driver-sqlite.sql":   `select 1`,
+			"query/for-driver-postgres.sql": `select 1::int`,
+		})
+		out, err := testRun(t, dir, "check")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "all queries ok\n" {
+			t.Errorf("wrong output:\n%s", out)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		dir := testDir(t, map[string]string{
+			"schema-sqlite.sql":  `create table x (i int);`,
+			"query/select-x.sql": `select * from x`,
+			"query/bad.gotxt":    `select {% .Foo `,
+		})
+		_, err := testRun(t, dir, "check")
+		if err == nil || !strings.Contains(err.Error(), "bad") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+func TestMigrateNew(t *testing.T) {
+	dir := t.TempDir()
+
+	out, err := testRun(t, dir, "migrate", "new", "add-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out2, err := testRun(t, dir, "migrate", "new", "add-y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "-1-add-x.sql\n") || !strings.HasSuffix(out2, "-2-add-y.sql\n") {
+		t.Errorf("wrong files:\n%s%s", out, out2)
+	}
+	if _, err := os.Stat(strings.TrimSpace(out2)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"zgo.at/zdb"
+	"zgo.at/zstd/zstring"
+)
+
+func cmdMigrate(ctx context.Context, files fs.FS, args []string) error {
+	if len(args) == 0 {
+		return errors.New("migrate: need a subcommand: status, up, down, plan, or new")
+	}
+
+	m, err := zdb.NewMigrate(zdb.MustGetDB(ctx), files, nil)
+	if err != nil {
+		return err
+	}
+	m.Log(func(name string) { fmt.Fprintln(stdout, "running migration", name) })
+
+	switch args[0] {
+	case "status":
+		haveMig, ranMig, err := m.List()
+		if err != nil {
+			return err
+		}
+		for _, h := range haveMig {
+			if zstring.Contains(ranMig, h) {
+				fmt.Fprintf(stdout, "ran      %s\n", h)
+			} else {
+				fmt.Fprintf(stdout, "pending  %s\n", h)
+			}
+		}
+		// Migrations in the version table without a file.
+		for _, r := range zstring.Difference(ranMig, haveMig) {
+			fmt.Fprintf(stdout, "unknown  %s\n", r)
+		}
+		return nil
+
+	case "up":
+		which := args[1:]
+		if len(which) == 0 {
+			which = []string{"all"}
+		}
+		return m.Run(which...)
+
+	case "down":
+		if len(args) > 2 {
+			return errors.New("migrate down: can only revert one migration at a time")
+		}
+		var name string
+		if len(args) == 2 {
+			name = args[1]
+		} else {
+			_, ranMig, err := m.List()
+			if err != nil {
+				return err
+			}
+			if len(ranMig) == 0 {
+				return errors.New("migrate down: no migrations have been run")
+			}
+			name = ranMig[len(ranMig)-1]
+		}
+		return m.Down(name)
+
+	case "plan":
+		haveMig, ranMig, err := m.List()
+		if err != nil {
+			return err
+		}
+		pending := zstring.Difference(haveMig, ranMig)
+		if len(pending) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+			return nil
+		}
+		for _, p := range pending {
+			s, err := m.Schema(p)
+			if err != nil {
+				s = "-- " + err.Error() // Go migrations.
+			}
+			fmt.Fprintf(stdout, "-- %s\n%s\n\n", p, strings.TrimSpace(s))
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("migrate: unknown subcommand: %q", args[0])
+	}
+}
+
+// migrateNew creates a new migration as "{date}-{n}-{name}.sql", where n is one
+// higher than any existing migration on the same day.
+func migrateNew(dir, name string) error {
+	dir = filepath.Join(dir, "migrate")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("migrate new: %w", err)
+	}
+
+	ls, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("migrate new: %w", err)
+	}
+	var (
+		date = time.Now().UTC().Format("2006-01-02")
+		n    = 1
+	)
+	for _, f := range ls {
+		if !strings.HasPrefix(f.Name(), date+"-") {
+			continue
+		}
+		i, err := strconv.Atoi(zstring.Upto(f.Name()[len(date)+1:], "-"))
+		if err == nil && i >= n {
+			n = i + 1
+		}
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("%s-%d-%s.sql", date, n, name))
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("migrate new: %q already exists", file)
+	}
+	err = os.WriteFile(file, []byte("-- Migration "+name+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("migrate new: %w", err)
+	}
+	fmt.Fprintln(stdout, file)
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"zgo.at/zdb"
+	"zgo.at/zstd/zstring"
+)
+
+// paramFlag collects "-p key=val" flags.
+type paramFlag zdb.P
+
+func (p paramFlag) String() string { return fmt.Sprintf("%v", zdb.P(p)) }
+
+// Set a parameter; values that look like an integer or boolean are converted,
+// so they work as expected in conditionals.
+func (p paramFlag) Set(v string) error {
+	k, val := zstring.Split2(v, "=")
+	if k == "" || !strings.Contains(v, "=") {
+		return fmt.Errorf("not in key=val format: %q", v)
+	}
+	if _, ok := p[k]; ok {
+		return fmt.Errorf("parameter given more than once: %q", k)
+	}
+
+	if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+		p[k] = n
+	} else if b, err := strconv.ParseBool(val); err == nil {
+		p[k] = b
+	} else {
+		p[k] = val
+	}
+	return nil
+}
+
+func cmdQuery(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("query: need a query name")
+	}
+	name := args[0]
+
+	var (
+		params = make(paramFlag)
+		f      = flag.NewFlagSet("query", flag.ContinueOnError)
+		format = f.String("format", "table", "")
+	)
+	f.Var(params, "p", "")
+	f.Usage = func() {} // Errors are already reported; see "zdb -h" for help.
+	err := f.Parse(args[1:])
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	if f.NArg() > 0 {
+		return fmt.Errorf("query: unknown arguments: %s", f.Args())
+	}
+
+	dump := zdb.DumpResult
+	switch *format {
+	case "table":
+	case "vertical":
+		dump |= zdb.DumpVertical
+	case "csv":
+		dump |= zdb.DumpCSV
+	case "json":
+		dump |= zdb.DumpJSON
+	case "html":
+		dump |= zdb.DumpHTML
+	default:
+		return fmt.Errorf("query: unknown -format %q", *format)
+	}
+
+	// Dump() doesn't return errors, so make sure the query can at least be
+	// loaded and prepared.
+	_, _, err = zdb.Prepare(ctx, "load:"+name, zdb.P(params))
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	zdb.Dump(ctx, stdout, "load:"+name, zdb.P(params), dump)
+	return nil
+}
+
+// cmdCheck loads all queries for this driver.
+func cmdCheck(ctx context.Context) error {
+	err := zdb.ValidateQueries(zdb.MustGetDB(ctx))
+	if err != nil {
+		return fmt.Errorf("check: %w", err)
+	}
+	fmt.Fprintln(stdout, "all queries ok")
+	return nil
+}
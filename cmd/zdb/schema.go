@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"zgo.at/zdb"
+)
+
+func schemaDump(ctx context.Context, connect string) error {
+	switch zdb.Driver(ctx) {
+	case zdb.DriverSQLite:
+		var tbls []string
+		err := zdb.Select(ctx, &tbls, `
+			select sql from sqlite_master
+			where sql is not null and name not like 'sqlite_%'
+			order by type = 'table' desc, name`)
+		if err != nil {
+			return fmt.Errorf("schema dump: %w", err)
+		}
+		for _, t := range tbls {
+			fmt.Fprintf(stdout, "%s;\n\n", t)
+		}
+		return nil
+
+	case zdb.DriverPostgreSQL:
+		// There's no good way to get the full schema from SQL, so leave it to
+		// pg_dump. Connection strings are in the same format as Connect():
+		// either key/value or URL-style.
+		args := []string{"--schema-only", "--no-owner", "--no-privileges"}
+		conn := connect[strings.Index(connect, "://")+3:]
+		switch {
+		case conn == "":
+			// Use PG* environment variables.
+		case strings.Contains(conn, "=") && !strings.ContainsAny(conn, "/@?"):
+			args = append(args, "--dbname", conn)
+		default:
+			args = append(args, "--dbname", connect)
+		}
+
+		cmd := exec.Command("pg_dump", args...)
+		cmd.Stdout, cmd.Stderr = stdout, os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("schema dump: pg_dump: %w", err)
+		}
+		return nil
+
+	case zdb.DriverMariaDB:
+		var tbls []string
+		err := zdb.Select(ctx, &tbls, `show tables`)
+		if err != nil {
+			return fmt.Errorf("schema dump: %w", err)
+		}
+		for _, t := range tbls {
+			rows, err := zdb.Query(ctx, "show create table `"+t+"`")
+			if err != nil {
+				return fmt.Errorf("schema dump: %w", err)
+			}
+			for rows.Next() {
+				var name, create string
+				err := rows.Scan(&name, &create)
+				if err != nil {
+					rows.Close()
+					return fmt.Errorf("schema dump: %w", err)
+				}
+				fmt.Fprintf(stdout, "%s;\n\n", create)
+			}
+			err = rows.Close()
+			if err != nil {
+				return fmt.Errorf("schema dump: %w", err)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("schema dump: unsupported driver %s", zdb.Driver(ctx))
+	}
+}
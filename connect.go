@@ -38,6 +38,62 @@ type ConnectOptions struct {
 	// that it won't attempt to run migrations.
 	Files fs.FS
 
+	// Maximum number of queries from Files to keep in memory after they're
+	// loaded with Load() or "load:"; 0 means no limit and -1 disables the
+	// cache.
+	QueryCache int
+
+	// Check the query files on every Load() and reload them if they changed,
+	// or if a file that takes precedence was added (such as name-sqlite.sql
+	// after name.sql was loaded). This allows editing queries with os.DirFS
+	// during development without restarting, but it needs a few Stat() calls
+	// for every Load(), so it's not recommended in production.
+	ReloadQueries bool
+
+	// Return an error if a {{:name ..}} conditional references a parameter
+	// that doesn't exist, instead of treating it as false.
+	StrictConditionals bool
+
+	// Return an error if a key in a map parameter (such as zdb.P) isn't used
+	// in the query or a conditional. Struct fields are never reported.
+	StrictParams bool
+
+	// Send slices used as "in (:x)" or "not in (:x)" as a single array
+	// parameter, rather than adding a placeholder for every element. This
+	// keeps the query text the same regardless of the number of elements,
+	// which works better with pg_stat_statements and prepared statements.
+	//
+	// The query is rewritten to:
+	//
+	//   PostgreSQL   = any($1), with pq.Array()
+	//   SQLite       in (select value from json_each(?)), as JSON
+	//   MariaDB      in (select [..] from json_table(?, [..])), as JSON
+	//
+	// This works for slices of integers and strings, and types that implement
+	// driver.Valuer or fmt.Stringer (such as UUID types). Slices used elsewhere
+	// in the query are still expanded.
+	//
+	// SQLite needs the JSON1 extension; for go-sqlite3 this means building with
+	// -tags=sqlite_json.
+	BindArrays bool
+
+	// Maximum number of prepared statements to cache; 0 disables the cache.
+	//
+	// Statements are cached by the final query text after Prepare(), so this
+	// works best with queries that don't change with every call (see
+	// BindArrays). Only single-statement select, insert, update, and delete
+	// queries are cached; the schema and migrations in Connect() never use the
+	// cache.
+	//
+	// Transactions prepare statements on the transaction's connection, and
+	// reuse them until the transaction ends; this uses the same limit. Use
+	// StmtStats() to get the hit rate.
+	StmtCache int
+
+	// Data passed to schema.gotxt, migrate/*.gotxt, and query/*.gotxt
+	// templates; see SchemaTemplateData and Load.
+	TemplateData interface{}
+
 	// In addition to migrations from .sql files, you can run migrations from Go
 	// functions. See the documentation on Migrate for details.
 	GoMigrations map[string]func(context.Context) error
@@ -142,7 +198,18 @@ func Connect(opt ConnectOptions) (DB, error) {
 		return nil, fmt.Errorf("zdb.Connect: %w", err)
 	}
 
-	db := &zDB{db: dbx, driver: driver}
+	db := &zDB{
+		db:      dbx,
+		driver:  driver,
+		qcache:  newQueryCache(opt.QueryCache, opt.ReloadQueries),
+		tplData: opt.TemplateData,
+		strict:  opt.StrictConditionals,
+		sparams: opt.StrictParams,
+		arrays:  opt.BindArrays,
+	}
+	// Don't use the statement cache for the schema and migrations; set it
+	// only once everything is done.
+	defer func() { db.stmts = newStmtCache(opt.StmtCache) }()
 
 	// These versions are required for zdb.
 	v, err := db.Version(WithDB(context.Background(), db))
@@ -168,6 +235,13 @@ func Connect(opt ConnectOptions) (DB, error) {
 		return nil, err
 	}
 
+	if opt.BindArrays && db.Driver() == DriverSQLite {
+		err := db.Exec(WithDB(context.Background(), db), `select json('[]')`)
+		if err != nil {
+			return nil, fmt.Errorf("zdb.Connect: BindArrays requires the SQLite JSON1 extension (build with -tags=sqlite_json): %w", err)
+		}
+	}
+
 	// No files for DB creation and migration: can just return now.
 	if opt.Files == nil {
 		return db, nil
@@ -188,7 +262,7 @@ func Connect(opt ConnectOptions) (DB, error) {
 			return nil, fmt.Errorf("zdb.Connect: %w", err)
 		}
 		if strings.HasSuffix(file, ".gotxt") {
-			s, err = SchemaTemplate(db.Driver(), string(s))
+			s, err = SchemaTemplateData(db.Driver(), string(s), opt.TemplateData)
 			if err != nil {
 				return nil, fmt.Errorf("zdb.Connect: %w", err)
 			}
@@ -212,6 +286,7 @@ func Connect(opt ConnectOptions) (DB, error) {
 			return nil, fmt.Errorf("zdb.Connect: %w", err)
 		}
 		m.Log(opt.MigrateLog)
+		m.TemplateData(opt.TemplateData)
 		err = m.Run(opt.Migrate...)
 		if err != nil {
 			return nil, fmt.Errorf("zdb.Connect: %w", err)
@@ -221,17 +296,41 @@ func Connect(opt ConnectOptions) (DB, error) {
 	return db, nil
 }
 
+// Suffixes for driver-specific files, in order of preference.
+var driverSuffixes = map[DriverType][]string{
+	DriverSQLite:     {"-sqlite", "-sqlite3"},
+	DriverPostgreSQL: {"-postgres", "-postgresql", "-psql"},
+	DriverMariaDB:    {"-mariadb", "-mysql"},
+}
+
 func insertDriver(db DB, name string) []string {
-	switch db.Driver() {
-	case DriverSQLite:
-		return []string{name + "-sqlite.sql", name + "-sqlite3.sql", name + ".gotxt", name + ".sql"}
-	case DriverPostgreSQL:
-		return []string{name + "-postgres.sql", name + "-postgresql.sql", name + "-psql.sql", name + ".gotxt", name + ".sql"}
-	case DriverMariaDB:
-		return []string{name + "-mysql.sql", name + ".gotxt", name + ".sql"}
-	default:
-		return []string{name + "-" + db.DriverName() + ".sql", name + ".gotxt", name + ".sql"}
+	suffixes, ok := driverSuffixes[db.Driver()]
+	if !ok {
+		suffixes = []string{"-" + db.DriverName()}
+	}
+	paths := make([]string, 0, len(suffixes)+2)
+	for _, s := range suffixes {
+		paths = append(paths, name+s+".sql")
+	}
+	return append(paths, name+".gotxt", name+".sql")
+}
+
+// fileDriver gets the driver a file is for from the suffix, and the name
+// without the driver suffix and extension. The driver is DriverUnknown if the
+// file is for all drivers.
+func fileDriver(file string) (DriverType, string) {
+	if !strings.HasSuffix(file, ".sql") {
+		return DriverUnknown, strings.TrimSuffix(file, ".gotxt")
+	}
+	name := strings.TrimSuffix(file, ".sql")
+	for d, suffixes := range driverSuffixes {
+		for _, s := range suffixes {
+			if strings.HasSuffix(name, s) {
+				return d, strings.TrimSuffix(name, s)
+			}
+		}
 	}
+	return DriverUnknown, name
 }
 
 func findFile(files fs.FS, paths ...string) ([]byte, string, error) {
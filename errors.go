@@ -0,0 +1,182 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// ErrorKind is the kind of database error; see ClassifyError().
+type ErrorKind uint8
+
+// Kinds of errors.
+const (
+	KindUnknown       ErrorKind = iota
+	KindUnique                  // UNIQUE or PRIMARY KEY constraint violation.
+	KindForeignKey              // FOREIGN KEY constraint violation.
+	KindNotNull                 // NOT NULL constraint violation.
+	KindCheck                   // CHECK constraint violation.
+	KindExclusion               // EXCLUDE constraint violation (PostgreSQL only).
+	KindDeadlock                // Deadlock detected, or table locked.
+	KindSerialization           // Serialization failure; the transaction can be retried.
+	KindReadOnly                // Write in a read-only transaction or database.
+	KindTimeout                 // Query timed out or was cancelled.
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindUnique:
+		return "unique"
+	case KindForeignKey:
+		return "foreign key"
+	case KindNotNull:
+		return "not null"
+	case KindCheck:
+		return "check"
+	case KindExclusion:
+		return "exclusion"
+	case KindDeadlock:
+		return "deadlock"
+	case KindSerialization:
+		return "serialization"
+	case KindReadOnly:
+		return "read only"
+	case KindTimeout:
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a database error, as returned by ClassifyError().
+type Error struct {
+	Kind ErrorKind
+
+	// Constraint, table, and column; these are set only if the driver provides
+	// them, and may be empty.
+	Constraint string
+	Table      string
+	Column     string
+
+	Err error // Original error.
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// ClassifyError gets information about a database error, such as a constraint
+// violation.
+//
+// This returns nil if err is nil or isn't a database error. Errors from the
+// database that aren't recognized have KindUnknown.
+//
+// SQLite errors are only recognized in cgo builds.
+func ClassifyError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		pqErr    *pq.Error
+		mysqlErr *mysql.MySQLError
+	)
+	switch {
+	case errors.As(err, &pqErr):
+		return classifyPostgreSQL(err, pqErr)
+	case errors.As(err, &mysqlErr):
+		return classifyMariaDB(err, mysqlErr)
+	}
+	if e := classifySQLite(err); e != nil {
+		return e
+	}
+	if errors.Is(err, ErrQueryTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: KindTimeout, Err: err}
+	}
+	return nil
+}
+
+// ErrUnique reports if this error reports a UNIQUE constraint violation.
+//
+// SQLite errors are only recognized in cgo builds.
+func ErrUnique(err error) bool {
+	e := ClassifyError(err)
+	return e != nil && e.Kind == KindUnique
+}
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+func classifyPostgreSQL(err error, pqErr *pq.Error) *Error {
+	e := &Error{Err: err, Constraint: pqErr.Constraint, Table: pqErr.Table, Column: pqErr.Column}
+	switch pqErr.Code {
+	case "23505":
+		e.Kind = KindUnique
+	case "23503":
+		e.Kind = KindForeignKey
+	case "23502":
+		e.Kind = KindNotNull
+	case "23514":
+		e.Kind = KindCheck
+	case "23P01":
+		e.Kind = KindExclusion
+	case "40P01":
+		e.Kind = KindDeadlock
+	case "40001":
+		e.Kind = KindSerialization
+	case "25006":
+		e.Kind = KindReadOnly
+	case "57014", "55P03": // query_canceled, lock_not_available
+		e.Kind = KindTimeout
+	}
+	return e
+}
+
+var (
+	reMariaKey        = regexp.MustCompile("for key '(?:([^'.]+)\\.)?([^']+)'")
+	reMariaConstraint = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	reMariaTable      = regexp.MustCompile("`[^`]+`\\.`([^`]+)`")
+	reMariaColumn     = regexp.MustCompile("(?:Column|Field) '([^']+)'")
+)
+
+// https://mariadb.com/kb/en/mariadb-error-codes/
+//
+// MariaDB doesn't have separate fields for the constraint etc. so we need to
+// get it from the message.
+func classifyMariaDB(err error, myErr *mysql.MySQLError) *Error {
+	e := &Error{Err: err}
+	switch myErr.Number {
+	case 1062, 1586: // ER_DUP_ENTRY, ER_DUP_ENTRY_WITH_KEY_NAME
+		e.Kind = KindUnique
+		if m := reMariaKey.FindStringSubmatch(myErr.Message); m != nil {
+			e.Table, e.Constraint = m[1], m[2]
+		}
+	case 1451, 1452, 1216, 1217: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2, and the old versions.
+		e.Kind = KindForeignKey
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		e.Kind = KindNotNull
+	case 4025, 3819: // ER_CONSTRAINT_FAILED, and MySQL's ER_CHECK_CONSTRAINT_VIOLATED
+		e.Kind = KindCheck
+	case 1213: // ER_LOCK_DEADLOCK
+		e.Kind = KindDeadlock
+	case 1792, 1290, 1836: // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION, ER_OPTION_PREVENTS_STATEMENT, ER_READ_ONLY_MODE
+		e.Kind = KindReadOnly
+	case 1205, 1969, 3024: // ER_LOCK_WAIT_TIMEOUT, ER_STATEMENT_TIMEOUT, and MySQL's ER_QUERY_TIMEOUT
+		e.Kind = KindTimeout
+	}
+
+	if e.Constraint == "" {
+		if m := reMariaConstraint.FindStringSubmatch(myErr.Message); m != nil {
+			e.Constraint = m[1]
+		}
+	}
+	if e.Table == "" {
+		if m := reMariaTable.FindStringSubmatch(myErr.Message); m != nil {
+			e.Table = m[1]
+		}
+	}
+	if m := reMariaColumn.FindStringSubmatch(myErr.Message); m != nil {
+		e.Column = m[1]
+	}
+	return e
+}
@@ -0,0 +1,109 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "<nil>"},
+		{errors.New("x"), "<nil>"},
+		{fmt.Errorf("x: %w", ErrQueryTimeout), "timeout   "},
+		{context.DeadlineExceeded, "timeout   "},
+
+		{&pq.Error{Code: "42601"}, "unknown"},
+		{&pq.Error{Code: "23505", Constraint: "c", Table: "t"}, "unique c t "},
+		{fmt.Errorf("x: %w", &pq.Error{Code: "23502", Table: "t", Column: "col"}), "not null  t col"},
+		{&pq.Error{Code: "23503", Constraint: "fk"}, "foreign key fk  "},
+		{&pq.Error{Code: "23514"}, "check   "},
+		{&pq.Error{Code: "23P01"}, "exclusion   "},
+		{&pq.Error{Code: "40P01"}, "deadlock   "},
+		{&pq.Error{Code: "40001"}, "serialization   "},
+		{&pq.Error{Code: "25006"}, "read only   "},
+		{&pq.Error{Code: "57014"}, "timeout   "},
+
+		{&mysql.MySQLError{Number: 1064}, "unknown"},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'test'"}, "unique test  "},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 't.test'"}, "unique test t "},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+			"(`db`.`child`, CONSTRAINT `child_ibfk_1` FOREIGN KEY (`p`) REFERENCES `parent` (`id`))"},
+			"foreign key child_ibfk_1 child "},
+		{&mysql.MySQLError{Number: 1048, Message: "Column 'c' cannot be null"}, "not null   c"},
+		{&mysql.MySQLError{Number: 4025, Message: "CONSTRAINT `chk` failed for `db`.`t`"}, "check chk t "},
+		{&mysql.MySQLError{Number: 1213}, "deadlock   "},
+		{&mysql.MySQLError{Number: 1792}, "read only   "},
+		{&mysql.MySQLError{Number: 1969}, "timeout   "},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			e := ClassifyError(tt.err)
+			have := "<nil>"
+			if e != nil {
+				have = e.Kind.String()
+				if e.Kind != KindUnknown {
+					have += fmt.Sprintf(" %s %s %s", e.Constraint, e.Table, e.Column)
+				}
+				if !errors.Is(e, tt.err) {
+					t.Error("doesn't unwrap to original error")
+				}
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorDB(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `
+		create table t (
+			id  integer primary key,
+			u   varchar(10) unique,
+			nn  varchar(10) not null,
+			chk int,
+			constraint chk_pos check (chk > 0)
+		)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Exec(ctx, `insert into t (id, u, nn, chk) values (1, 'a', 'x', 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		wantKind ErrorKind
+	}{
+		{`insert into t (id, u, nn) values (2, 'a', 'x')`, KindUnique},
+		{`insert into t (id, u, nn) values (1, 'b', 'x')`, KindUnique},
+		{`insert into t (id, u, nn) values (3, 'c', null)`, KindNotNull},
+		{`insert into t (id, u, nn, chk) values (4, 'd', 'x', -1)`, KindCheck},
+		{`select nonexistent from t`, KindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			err := Exec(ctx, tt.query)
+			e := ClassifyError(err)
+			if e == nil {
+				t.Fatalf("nil error for %v", err)
+			}
+			if e.Kind != tt.wantKind {
+				t.Errorf("kind %s; want %s (%v)", e.Kind, tt.wantKind, err)
+			}
+		})
+	}
+}
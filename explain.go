@@ -0,0 +1,330 @@
+package zdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plan is a node in a query plan; see Explain().
+type Plan struct {
+	Node   string // Node type, e.g. "Seq Scan" (PostgreSQL), "ALL" (MariaDB), or "SCAN" (SQLite).
+	Table  string // Table name; may be empty.
+	Index  string // Index name; may be empty.
+	Detail string // Human-readable description.
+
+	// Full table scan: "Seq Scan" on PostgreSQL, "ALL" on MariaDB, and "SCAN"
+	// without an index on SQLite.
+	FullScan bool
+
+	Rows       float64       // Estimated number of rows; 0 if unknown.
+	ActualRows float64       // Actual number of rows, if the query was run.
+	Time       time.Duration // Actual time, if the query was run.
+
+	// All other fields the database returned; this is empty for SQLite.
+	Extra map[string]interface{}
+
+	Children []*Plan
+}
+
+// Walk calls fn for this plan node and all its children, depth-first.
+func (p *Plan) Walk(fn func(p *Plan, depth int)) { p.walk(fn, 0) }
+
+func (p *Plan) walk(fn func(*Plan, int), depth int) {
+	fn(p, depth)
+	for _, c := range p.Children {
+		c.walk(fn, depth+1)
+	}
+}
+
+// String shows the plan as an indented tree.
+func (p *Plan) String() string {
+	b := new(strings.Builder)
+	p.Walk(func(p *Plan, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(p.Detail)
+		var s []string
+		if p.Rows > 0 {
+			s = append(s, fmt.Sprintf("rows=%g", p.Rows))
+		}
+		if p.ActualRows > 0 {
+			s = append(s, fmt.Sprintf("actual_rows=%g", p.ActualRows))
+		}
+		if p.Time > 0 {
+			s = append(s, "time="+p.Time.String())
+		}
+		if len(s) > 0 {
+			b.WriteString("  (" + strings.Join(s, " ") + ")")
+		}
+		b.WriteByte('\n')
+	})
+	return b.String()
+}
+
+// Explain gets the query plan as a tree.
+//
+// This uses "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON)" on PostgreSQL,
+// "ANALYZE FORMAT=JSON" on MariaDB, and "EXPLAIN QUERY PLAN" on SQLite.
+//
+// ANALYZE means the query is actually run; for queries that modify data plain
+// EXPLAIN is used, so the plan won't have the actual rows and time.
+//
+// The query and parameters are passed to Prepare() first, and any DB wrappers
+// such as LogDB are ignored.
+func Explain(ctx context.Context, query string, params ...interface{}) (*Plan, error) {
+	return explainPlan(ctx, query, true, params)
+}
+
+// explainPlan gets the query plan; if analyze is false then ANALYZE is never used,
+// so the query is never run.
+func explainPlan(ctx context.Context, query string, analyze bool, params []interface{}) (*Plan, error) {
+	query, params, err := Prepare(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("zdb.Explain: %w", err)
+	}
+
+	var (
+		db    = MustGetDB(ctx)
+		write = !analyze || isWrite(query)
+		plan  *Plan
+	)
+	ctx = WithDB(ctx, Unwrap(db))
+	switch db.Driver() {
+	default:
+		err = errors.New("unsupported driver " + db.DriverName())
+	case DriverPostgreSQL:
+		plan, err = explainPostgreSQL(ctx, query, write, params)
+	case DriverMariaDB:
+		plan, err = explainMariaDB(ctx, query, write, params)
+	case DriverSQLite:
+		plan, err = explainSQLite(ctx, query, params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zdb.Explain: %w", err)
+	}
+	return plan, nil
+}
+
+func explainPostgreSQL(ctx context.Context, query string, write bool, params []interface{}) (*Plan, error) {
+	prefix := `explain (analyze, buffers, format json) `
+	if write {
+		prefix = `explain (format json) `
+	}
+	var j string
+	err := Get(ctx, &j, prefix+query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []map[string]interface{}
+	err = json.Unmarshal([]byte(j), &out)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no plan")
+	}
+	root, ok := out[0]["Plan"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("no plan")
+	}
+
+	plan := pgPlan(root)
+	for k, v := range out[0] {
+		if k != "Plan" {
+			plan.Extra[k] = v
+		}
+	}
+	return plan, nil
+}
+
+func pgPlan(n map[string]interface{}) *Plan {
+	p := &Plan{Extra: make(map[string]interface{})}
+	loops := 1.0
+	if l, ok := n["Actual Loops"].(float64); ok {
+		loops = l
+	}
+	for k, v := range n {
+		switch k {
+		case "Node Type":
+			p.Node, _ = v.(string)
+		case "Relation Name":
+			p.Table, _ = v.(string)
+		case "Index Name":
+			p.Index, _ = v.(string)
+		case "Plan Rows":
+			p.Rows, _ = v.(float64)
+		case "Actual Rows":
+			r, _ := v.(float64)
+			p.ActualRows = r * loops
+		case "Actual Total Time": // ms
+			t, _ := v.(float64)
+			p.Time = time.Duration(t * loops * float64(time.Millisecond))
+		case "Plans":
+			children, _ := v.([]interface{})
+			for _, c := range children {
+				if cc, ok := c.(map[string]interface{}); ok {
+					p.Children = append(p.Children, pgPlan(cc))
+				}
+			}
+		default:
+			p.Extra[k] = v
+		}
+	}
+
+	p.FullScan = p.Node == "Seq Scan"
+	p.Detail = p.Node
+	if p.Index != "" {
+		p.Detail += " using " + p.Index
+	}
+	if p.Table != "" {
+		p.Detail += " on " + p.Table
+	}
+	return p
+}
+
+func explainMariaDB(ctx context.Context, query string, write bool, params []interface{}) (*Plan, error) {
+	prefix := `analyze format=json `
+	if write {
+		prefix = `explain format=json `
+	}
+	var j string
+	err := Get(ctx, &j, prefix+query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var out map[string]interface{}
+	err = json.Unmarshal([]byte(j), &out)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := out["query_block"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("no plan")
+	}
+	return mariaPlan("query_block", root), nil
+}
+
+// The MariaDB JSON format doesn't have a consistent "node" structure like
+// PostgreSQL; tables are in a "table" key, and everything else (nested_loop,
+// filesort, subqueries, etc.) is an object or array with the operation as the
+// key. Every object becomes a node, with the scalar values in Extra.
+func mariaPlan(key string, n map[string]interface{}) *Plan {
+	p := &Plan{Node: key, Detail: key, Extra: make(map[string]interface{})}
+
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch v := n[k].(type) {
+		case map[string]interface{}:
+			p.Children = append(p.Children, mariaPlan(k, v))
+		case []interface{}:
+			var (
+				objs []*Plan
+				vals []interface{}
+			)
+			for _, e := range v {
+				eo, ok := e.(map[string]interface{})
+				if !ok {
+					vals = append(vals, e)
+					continue
+				}
+				// [{"table": {..}}, {"table": {..}}]
+				if ek, evo, ok := singleObject(eo); ok {
+					objs = append(objs, mariaPlan(ek, evo))
+					continue
+				}
+				objs = append(objs, mariaPlan(k, eo))
+			}
+			if len(vals) > 0 {
+				p.Extra[k] = vals
+			}
+			if len(objs) > 0 {
+				p.Children = append(p.Children, &Plan{Node: k, Detail: k, Extra: map[string]interface{}{}, Children: objs})
+			}
+		default:
+			p.Extra[k] = v
+		}
+	}
+
+	if key == "table" {
+		p.Node, _ = p.Extra["access_type"].(string)
+		p.Table, _ = p.Extra["table_name"].(string)
+		p.Index, _ = p.Extra["key"].(string)
+		p.Rows, _ = p.Extra["rows"].(float64)
+		p.ActualRows, _ = p.Extra["r_rows"].(float64)
+		if loops, ok := p.Extra["r_loops"].(float64); ok {
+			p.ActualRows *= loops
+		}
+		if t, ok := p.Extra["r_total_time_ms"].(float64); ok {
+			p.Time = time.Duration(t * float64(time.Millisecond))
+		}
+		for _, k := range []string{"access_type", "table_name", "key", "rows", "r_rows", "r_total_time_ms"} {
+			delete(p.Extra, k)
+		}
+
+		p.FullScan = p.Node == "ALL"
+		p.Detail = p.Node + " on " + p.Table
+		if p.Index != "" {
+			p.Detail += " using " + p.Index
+		}
+	}
+	return p
+}
+
+// Get the key and value if this object has just one key with an object as the
+// value.
+func singleObject(o map[string]interface{}) (string, map[string]interface{}, bool) {
+	if len(o) != 1 {
+		return "", nil, false
+	}
+	for k, v := range o {
+		if vo, ok := v.(map[string]interface{}); ok {
+			return k, vo, true
+		}
+	}
+	return "", nil, false
+}
+
+var reSQLitePlan = regexp.MustCompile(`^(SCAN|SEARCH)(?: TABLE)? (\S+)(?: AS \S+)?(?: USING (?:COVERING |INTEGER PRIMARY KEY)?(?:INDEX (\S+))?)?`)
+
+func explainSQLite(ctx context.Context, query string, params []interface{}) (*Plan, error) {
+	var rows []struct {
+		ID, Parent, Notused int
+		Detail              string
+	}
+	// EXPLAIN QUERY PLAN never runs the query, so there's no ANALYZE.
+	err := Select(ctx, &rows, `explain query plan `+query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		root  = &Plan{Node: "QUERY PLAN", Detail: "QUERY PLAN"}
+		nodes = map[int]*Plan{0: root}
+	)
+	for _, r := range rows {
+		p := &Plan{Node: r.Detail, Detail: r.Detail}
+		if m := reSQLitePlan.FindStringSubmatch(r.Detail); m != nil {
+			p.Node, p.Table, p.Index = m[1], m[2], m[3]
+			p.FullScan = p.Node == "SCAN" && !strings.Contains(r.Detail, " USING ")
+		}
+		nodes[r.ID] = p
+
+		parent, ok := nodes[r.Parent]
+		if !ok {
+			parent = root
+		}
+		parent.Children = append(parent.Children, p)
+	}
+	return root, nil
+}
@@ -0,0 +1,107 @@
+package zdb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table x (i int, j int); create index x_j on x(j);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Explain(ctx, `select * from x where i = :i`, P{"i": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scans []string
+	plan.Walk(func(p *Plan, _ int) {
+		if p.FullScan {
+			scans = append(scans, p.Table)
+		}
+	})
+	if len(scans) != 1 || scans[0] != "x" {
+		t.Errorf("wrong full scans %v in:\n%s", scans, plan)
+	}
+
+	plan, err = Explain(ctx, `select * from x where j = ?`, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Driver(ctx) == DriverSQLite {
+		want := "QUERY PLAN\n  SEARCH TABLE x USING INDEX x_j (j=?)\n"
+		if have := plan.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+		if c := plan.Children[0]; c.FullScan || c.Index != "x_j" || c.Table != "x" || c.Node != "SEARCH" {
+			t.Errorf("%#v", c)
+		}
+	}
+}
+
+func TestExplainParse(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		var j map[string]interface{}
+		err := json.Unmarshal([]byte(`{
+			"Node Type": "Nested Loop", "Plan Rows": 10, "Actual Rows": 2, "Actual Loops": 1, "Actual Total Time": 1.5,
+			"Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "x", "Plan Rows": 850, "Actual Rows": 2, "Actual Loops": 1, "Filter": "(i < 3)"},
+				{"Node Type": "Index Scan", "Relation Name": "y", "Index Name": "y_pkey", "Actual Rows": 1, "Actual Loops": 2, "Actual Total Time": 0.25}
+			]}`), &j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan := pgPlan(j)
+
+		want := "Nested Loop  (rows=10 actual_rows=2 time=1.5ms)\n" +
+			"  Seq Scan on x  (rows=850 actual_rows=2)\n" +
+			"  Index Scan using y_pkey on y  (actual_rows=2 time=500µs)\n"
+		if have := plan.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+		if !plan.Children[0].FullScan || plan.Children[1].FullScan {
+			t.Error("FullScan wrong")
+		}
+		if plan.Children[0].Extra["Filter"] != "(i < 3)" {
+			t.Errorf("%v", plan.Children[0].Extra)
+		}
+	})
+
+	t.Run("mariadb", func(t *testing.T) {
+		var j map[string]interface{}
+		err := json.Unmarshal([]byte(`{
+			"select_id": 1, "r_loops": 1, "r_total_time_ms": 0.1,
+			"filesort": {
+				"sort_key": "x.i",
+				"nested_loop": [
+					{"table": {"table_name": "x", "access_type": "ALL", "rows": 5, "r_loops": 1, "r_rows": 5, "r_total_time_ms": 0.02, "attached_condition": "x.i < 3"}},
+					{"table": {"table_name": "y", "access_type": "eq_ref", "key": "PRIMARY", "rows": 1, "r_loops": 2, "r_rows": 1}}
+				]
+			}}`), &j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan := mariaPlan("query_block", j)
+
+		want := "query_block\n" +
+			"  filesort\n" +
+			"    nested_loop\n" +
+			"      ALL on x  (rows=5 actual_rows=5 time=20µs)\n" +
+			"      eq_ref on y using PRIMARY  (rows=1 actual_rows=2)\n"
+		if have := plan.String(); have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+
+		x := plan.Children[0].Children[0].Children[0]
+		if !x.FullScan || x.Time != 20*time.Microsecond || x.Extra["attached_condition"] != "x.i < 3" {
+			t.Errorf("%#v", x)
+		}
+		if plan.Extra["select_id"] != 1.0 || plan.Children[0].Extra["sort_key"] != "x.i" {
+			t.Errorf("%v %v", plan.Extra, plan.Children[0].Extra)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"zgo.at/zstd/ztest"
+)
+
+// GoldenRule normalizes volatile values in the output of Golden().
+type GoldenRule struct {
+	// Column name pattern, matched case-insensitive with path.Match(). An empty
+	// string matches all columns.
+	Column string
+
+	// Only replace values matching this regular expression, with the value
+	// formatted as in Dump(). Replace can use $1 etc. for submatches. If this
+	// is nil then every non-NULL value is replaced.
+	Match *regexp.Regexp
+
+	// Replacement.
+	Replace string
+}
+
+// Rules applied after the GoldenRule parameters; this replaces all timestamps
+// with "[timestamp]".
+var defaultGoldenRules = []GoldenRule{
+	{Match: regexp.MustCompile(`^\d{4}-\d\d-\d\d[ T]\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:?\d\d)?$`), Replace: "[timestamp]"},
+}
+
+func (r GoldenRule) apply(col string, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if r.Column != "" {
+		if ok, _ := path.Match(strings.ToLower(r.Column), strings.ToLower(col)); !ok {
+			return v, false
+		}
+	}
+	if r.Match == nil {
+		return r.Replace, true
+	}
+	s := formatParam(v, false)
+	if !r.Match.MatchString(s) {
+		return v, false
+	}
+	return r.Match.ReplaceAllString(s, r.Replace), true
+}
+
+// Golden compares the result of a query to the golden file
+// testdata/[name].golden.
+//
+// Set ZDB_UPDATE_GOLDEN=1 to write the current result to the file:
+//
+//   ZDB_UPDATE_GOLDEN=1 go test -run TestSites
+//
+// The result is formatted as in Dump(); DumpCSV and DumpJSON can be added as
+// parameters to use that format.
+//
+// Volatile values are normalized with GoldenRule parameters, for example to
+// replace serial IDs:
+//
+//   zdb.Golden(t, ctx, "sites", `select * from sites`,
+//       zdb.GoldenRule{Column: "site_id", Replace: "[id]"})
+//
+// Only the first rule that matches a value is applied. Timestamps are always
+// replaced with "[timestamp]" if no other rule matched. Both these kind of
+// parameters are not sent to the database.
+func Golden(t testing.TB, ctx context.Context, name, query string, params ...interface{}) {
+	t.Helper()
+
+	var dump DumpArg
+	params = dump.extract(params)
+	rules := make([]GoldenRule, 0, len(defaultGoldenRules))
+	for i := 0; i < len(params); i++ {
+		if r, ok := params[i].(GoldenRule); ok {
+			rules = append(rules, r)
+			params = append(params[:i:i], params[i+1:]...)
+			i--
+		}
+	}
+	rules = append(rules, defaultGoldenRules...)
+
+	have, err := golden(ctx, dump, rules, query, params)
+	if err != nil {
+		t.Fatalf("zdb.Golden: %s", err)
+	}
+
+	file := filepath.Join("testdata", name+".golden")
+	if os.Getenv("ZDB_UPDATE_GOLDEN") == "1" {
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err == nil {
+			err = os.WriteFile(file, have, 0644)
+		}
+		if err != nil {
+			t.Fatalf("zdb.Golden: %s", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Fatalf("zdb.Golden: %s does not exist; run with ZDB_UPDATE_GOLDEN=1 to create it", file)
+		}
+		t.Fatalf("zdb.Golden: %s", err)
+	}
+	if d := ztest.Diff(string(have), string(want)); d != "" {
+		t.Errorf("zdb.Golden: %s\n%s", file, d)
+	}
+}
+
+func golden(ctx context.Context, dump DumpArg, rules []GoldenRule, query string, params []interface{}) ([]byte, error) {
+	rows, err := Query(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	all, err := scanAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range all {
+		for i := range row {
+			for _, r := range rules {
+				if v, ok := r.apply(cols[i], row[i]); ok {
+					row[i] = v
+					break
+				}
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	switch {
+	default:
+		err = writeHorizontal(buf, cols, all)
+	case dump.has(DumpCSV):
+		err = writeCSV(buf, cols, all)
+	case dump.has(DumpJSON):
+		err = writeJSON(buf, cols, all)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,65 @@
+package zdb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table x (id int, name varchar(255), created_at timestamp);
+		insert into x values
+			(1, 'one', '2021-06-01 12:00:00'),
+			(2, 'two', '2021-06-02 12:00:00'),
+			(3, 'three', null);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := `select * from x order by name`
+	Golden(t, ctx, "golden/horizontal", q)
+	Golden(t, ctx, "golden/csv", q, DumpCSV, GoldenRule{Column: "ID", Replace: "[id]"})
+	Golden(t, ctx, "golden/json", `select name from x where id = ?`, 2, DumpJSON,
+		GoldenRule{Match: regexp.MustCompile(`^t(.+)`), Replace: "T$1"})
+
+	t.Run("mismatch", func(t *testing.T) {
+		if os.Getenv("ZDB_UPDATE_GOLDEN") == "1" {
+			t.Skip("ZDB_UPDATE_GOLDEN is set")
+		}
+		tb := &errorsTB{TB: t}
+		Golden(tb, ctx, "golden/horizontal", `select * from x where id < 3 order by name`)
+		if len(tb.errs) != 1 || !strings.Contains(tb.errs[0], "+ 3   three  NULL") {
+			t.Errorf("wrong errors:\n%s", strings.Join(tb.errs, "\n"))
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp := t.TempDir()
+		if err := os.Chdir(tmp); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+
+		defer os.Setenv("ZDB_UPDATE_GOLDEN", os.Getenv("ZDB_UPDATE_GOLDEN"))
+		os.Setenv("ZDB_UPDATE_GOLDEN", "1")
+		Golden(t, ctx, "new", `select id from x where id = 1`)
+		os.Setenv("ZDB_UPDATE_GOLDEN", "")
+
+		have, err := os.ReadFile(filepath.Join(tmp, "testdata", "new.golden"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "id\n1\n"; string(have) != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+		Golden(t, ctx, "new", `select id from x where id = 1`)
+	})
+}
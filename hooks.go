@@ -0,0 +1,117 @@
+package zdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Hooks are called before and after queries and transactions; see
+// WithHooks().
+//
+// This is intended to integrate with tracing libraries such as OpenTelemetry:
+// the Before hooks can start a span and return a context with it, which is then
+// used for the query (or transaction) and passed to the After hooks to end the
+// span.
+type Hooks interface {
+	// BeforeQuery is called before a query is sent to the database. The query
+	// is the prepared query as sent to the database, with the /* name */
+	// comment if it was loaded with Load().
+	BeforeQuery(ctx context.Context, query string, params []interface{}) context.Context
+
+	// AfterQuery is called after the query finished. For Query() this is
+	// called once the query returned, which is before all rows are read.
+	AfterQuery(ctx context.Context, query string, params []interface{}, err error)
+
+	// BeforeBegin is called before a transaction is started. The returned
+	// context is used for the transaction and passed to AfterCommit and
+	// AfterRollback.
+	BeforeBegin(ctx context.Context) context.Context
+
+	// AfterCommit is called after the transaction was committed.
+	AfterCommit(ctx context.Context, err error)
+
+	// AfterRollback is called after the transaction was rolled back, or when
+	// starting the transaction failed.
+	AfterRollback(ctx context.Context, err error)
+}
+
+type hooksDB struct {
+	DB
+	hooks Hooks
+	txctx context.Context // Context from BeforeBegin; nil if not a transaction.
+	done  *bool           // Transaction is committed or rolled back.
+}
+
+// WithHooks returns a DB wrapper which calls hooks for every query and
+// transaction.
+//
+// Hooks are not called for nested transactions, as Begin() is a no-op for
+// them, and only the first Commit() or Rollback() will call the hooks, so that
+// the usual "defer tx.Rollback()" doesn't call AfterRollback after a
+// successful commit.
+func WithHooks(db DB, hooks Hooks) DB {
+	return &hooksDB{DB: db, hooks: hooks}
+}
+
+func (d hooksDB) Unwrap() DB { return d.DB }
+
+func (d hooksDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
+	if _, ok := Unwrap(d.DB).(*zTX); ok {
+		return ctx, &d, ErrTransactionStarted
+	}
+
+	hctx := d.hooks.BeforeBegin(ctx)
+	txctx, tx, err := d.DB.Begin(hctx, opts...)
+	if err != nil {
+		d.hooks.AfterRollback(hctx, err)
+		return nil, nil, err
+	}
+	hdb := &hooksDB{DB: tx, hooks: d.hooks, txctx: hctx, done: new(bool)}
+	return WithDB(txctx, hdb), hdb, nil
+}
+
+func (d hooksDB) Commit() error {
+	err := d.DB.Commit()
+	if d.txctx != nil && !*d.done {
+		*d.done = true
+		d.hooks.AfterCommit(d.txctx, err)
+	}
+	return err
+}
+
+func (d hooksDB) Rollback() error {
+	err := d.DB.Rollback()
+	if d.txctx != nil && !*d.done && !errors.Is(err, sql.ErrTxDone) {
+		*d.done = true
+		d.hooks.AfterRollback(d.txctx, err)
+	}
+	return err
+}
+
+func (d hooksDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	ctx = d.hooks.BeforeQuery(ctx, query, params)
+	r, err := d.DB.(dbImpl).ExecContext(ctx, query, params...)
+	d.hooks.AfterQuery(ctx, query, params, err)
+	return r, err
+}
+func (d hooksDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	ctx = d.hooks.BeforeQuery(ctx, query, params)
+	err := d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
+	d.hooks.AfterQuery(ctx, query, params, err)
+	return err
+}
+func (d hooksDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	ctx = d.hooks.BeforeQuery(ctx, query, params)
+	err := d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
+	d.hooks.AfterQuery(ctx, query, params, err)
+	return err
+}
+func (d hooksDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	ctx = d.hooks.BeforeQuery(ctx, query, params)
+	r, err := d.DB.(dbImpl).QueryxContext(ctx, query, params...)
+	d.hooks.AfterQuery(ctx, query, params, err)
+	return r, err
+}
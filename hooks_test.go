@@ -0,0 +1,85 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+type testHooks struct{ log []string }
+
+func (h *testHooks) BeforeQuery(ctx context.Context, query string, params []interface{}) context.Context {
+	h.log = append(h.log, fmt.Sprintf("before query %q %v span=%v", strings.TrimSpace(query), params, ctx.Value(ctxKey{})))
+	return context.WithValue(ctx, ctxKey{}, "query")
+}
+func (h *testHooks) AfterQuery(ctx context.Context, query string, params []interface{}, err error) {
+	h.log = append(h.log, fmt.Sprintf("after query span=%v err=%v", ctx.Value(ctxKey{}), err != nil))
+}
+func (h *testHooks) BeforeBegin(ctx context.Context) context.Context {
+	h.log = append(h.log, "begin")
+	return context.WithValue(ctx, ctxKey{}, "tx")
+}
+func (h *testHooks) AfterCommit(ctx context.Context, err error) {
+	h.log = append(h.log, fmt.Sprintf("commit span=%v err=%v", ctx.Value(ctxKey{}), err))
+}
+func (h *testHooks) AfterRollback(ctx context.Context, err error) {
+	h.log = append(h.log, fmt.Sprintf("rollback span=%v err=%v", ctx.Value(ctxKey{}), err))
+}
+
+func TestWithHooks(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table x (i int)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := new(testHooks)
+	ctx = WithDB(context.Background(), WithHooks(Unwrap(MustGetDB(ctx)), h))
+
+	err = Exec(ctx, `insert into x values (?)`, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TX(ctx, func(ctx context.Context) error {
+		err := TX(ctx, func(ctx context.Context) error { // Nested, no hooks.
+			return Exec(ctx, `insert into x values (2)`)
+		})
+		if err != nil {
+			return err
+		}
+		var i []struct{ I int }
+		return Select(ctx, &i, `select i from x`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TX(ctx, func(ctx context.Context) error {
+		return Exec(ctx, `select nonexistent from x`)
+	})
+	if err == nil {
+		t.Fatal("no error")
+	}
+
+	want := []string{
+		fmt.Sprintf(`before query %q [1] span=<nil>`, MustGetDB(ctx).Rebind(`insert into x values (?)`)),
+		`after query span=query err=false`,
+		`begin`,
+		`before query "insert into x values (2)" [] span=tx`,
+		`after query span=query err=false`,
+		`before query "select i from x" [] span=tx`,
+		`after query span=query err=false`,
+		`commit span=tx err=<nil>`,
+		`begin`,
+		`before query "select nonexistent from x" [] span=tx`,
+		`after query span=query err=true`,
+		`rollback span=tx err=<nil>`,
+	}
+	if !reflect.DeepEqual(h.log, want) {
+		t.Errorf("\nhave:\n%s\n\nwant:\n%s", strings.Join(h.log, "\n"), strings.Join(want, "\n"))
+	}
+}
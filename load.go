@@ -0,0 +1,167 @@
+package zdb
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zgo.at/zstd/zstring"
+)
+
+// queryCache is a LRU cache for queries loaded with Load().
+//
+// If reload is set the files are checked on every access, and the entry is
+// reloaded if the file changed or if a file with a higher precedence was added
+// (e.g. name-sqlite.sql after name.sql was loaded). This allows editing
+// queries during development without restarting.
+type queryCache struct {
+	mu     sync.Mutex
+	max    int  // 0 for no limit.
+	reload bool // Check files on every access.
+	lru    *list.List
+	items  map[string]*list.Element
+}
+
+type queryCacheEntry struct {
+	name  string // Query name as passed to Load().
+	file  string // File it was loaded from.
+	query string // Processed query.
+	mtime time.Time
+}
+
+func newQueryCache(max int, reload bool) *queryCache {
+	if max < 0 {
+		return nil
+	}
+	return &queryCache{max: max, reload: reload, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Report if the files need to be checked.
+func (c *queryCache) reloads() bool { return c != nil && c.reload }
+
+// Get the query from the cache; paths are the files to look for in order of
+// precedence, as from insertDriver().
+func (c *queryCache) get(files fs.FS, name string, paths []string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[name]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*queryCacheEntry)
+	if c.reload {
+		file, mtime := statFirst(files, paths)
+		if file != entry.file || !mtime.Equal(entry.mtime) {
+			c.lru.Remove(e)
+			delete(c.items, name)
+			return "", false
+		}
+	}
+
+	c.lru.MoveToFront(e)
+	return entry.query, true
+}
+
+func (c *queryCache) set(name, file, query string, mtime time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[name]; ok {
+		c.lru.Remove(e)
+	}
+	c.items[name] = c.lru.PushFront(&queryCacheEntry{name: name, file: file, query: query, mtime: mtime})
+
+	if c.max > 0 {
+		for c.lru.Len() > c.max {
+			e := c.lru.Back()
+			c.lru.Remove(e)
+			delete(c.items, e.Value.(*queryCacheEntry).name)
+		}
+	}
+}
+
+// Get the first file in paths that exists and its modification time.
+func statFirst(files fs.FS, paths []string) (string, time.Time) {
+	for _, p := range paths {
+		if st, err := fs.Stat(files, p); err == nil {
+			return p, st.ModTime()
+		}
+	}
+	return "", time.Time{}
+}
+
+// ValidateQueries loads all queries from the query directory for the driver,
+// so that missing or invalid files can be reported on startup rather than the
+// first time a query is run.
+//
+// Queries are added to the cache (if enabled), so this also serves to "warm
+// up" the cache.
+//
+// Returns nil if there are no query files.
+func ValidateQueries(db DB) error {
+	files := Unwrap(db).(interface{ queryFiles() fs.FS }).queryFiles()
+	if files == nil {
+		return nil
+	}
+
+	names, err := listQueries(files, db.Driver())
+	if err != nil {
+		return fmt.Errorf("zdb.ValidateQueries: %w", err)
+	}
+
+	ctx := WithDB(context.Background(), db)
+	var errs []string
+	for _, n := range names {
+		_, err := loadImpl(ctx, db, n)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("zdb.ValidateQueries: %d errors:\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// listQueries lists the names of all queries for the driver.
+func listQueries(files fs.FS, driver DriverType) ([]string, error) {
+	ls, err := fs.ReadDir(files, ".")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ls))
+	for _, f := range ls {
+		n := f.Name()
+		if f.IsDir() || strings.HasSuffix(n, "_test.sql") || !zstring.HasSuffixes(n, ".sql", ".gotxt") {
+			continue
+		}
+
+		isFor, name := fileDriver(n)
+		if isFor != DriverUnknown && isFor != driver {
+			continue
+		}
+		names = append(names, name)
+	}
+	names = zstring.Uniq(names)
+	sort.Strings(names)
+	return names, nil
+}
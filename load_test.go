@@ -0,0 +1,152 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"zgo.at/zdb/testdata"
+	"zgo.at/zstd/ztest"
+)
+
+func TestQueryCache(t *testing.T) {
+	files := fstest.MapFS{}
+	c := newQueryCache(2, false)
+
+	c.set("a", "a.sql", "A", time.Time{})
+	c.set("b", "b.sql", "B", time.Time{})
+	if q, ok := c.get(files, "a", nil); !ok || q != "A" {
+		t.Errorf("a: %q %t", q, ok)
+	}
+
+	c.set("c", "c.sql", "C", time.Time{}) // Evicts b, as a was used.
+	if _, ok := c.get(files, "b", nil); ok {
+		t.Error("b still in cache")
+	}
+	if q, ok := c.get(files, "a", nil); !ok || q != "A" {
+		t.Errorf("a: %q %t", q, ok)
+	}
+	if q, ok := c.get(files, "c", nil); !ok || q != "C" {
+		t.Errorf("c: %q %t", q, ok)
+	}
+
+	var nilCache *queryCache
+	nilCache.set("a", "a.sql", "A", time.Time{})
+	if _, ok := nilCache.get(files, "a", nil); ok {
+		t.Error("nil cache")
+	}
+}
+
+func TestLoadReload(t *testing.T) {
+	for _, reload := range []bool{false, true} {
+		t.Run(fmt.Sprintf("%t", reload), func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.MkdirAll(filepath.Join(dir, "query"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(dir, "query", "q.sql")
+			err = os.WriteFile(file, []byte("select 1"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(filepath.Join(dir, "schema.sql"), []byte("select 1"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := Connect(ConnectOptions{
+				Connect:       "sqlite3://:memory:",
+				Files:         os.DirFS(dir),
+				ReloadQueries: reload,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			ctx := WithDB(context.Background(), db)
+
+			load := func(want string) {
+				t.Helper()
+				got, err := Load(ctx, "q")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want = "/* q */\n" + want + "\n"; got != want {
+					t.Errorf("\ngot:  %q\nwant: %q", got, want)
+				}
+			}
+			ifReload := func(yes, no string) string {
+				if reload {
+					return yes
+				}
+				return no
+			}
+
+			load("select 1")
+
+			// Changed file.
+			err = os.WriteFile(file, []byte("select 2"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mtime := time.Now().Add(time.Minute)
+			err = os.Chtimes(file, mtime, mtime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			load(ifReload("select 2", "select 1"))
+
+			// New driver-specific file.
+			err = os.WriteFile(filepath.Join(dir, "query", "q-sqlite.sql"), []byte("select 3"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			load(ifReload("select 3", "select 1"))
+		})
+	}
+}
+
+func TestValidateQueries(t *testing.T) {
+	{
+		db, err := Connect(ConnectOptions{
+			Connect: "sqlite3://:memory:",
+			Files:   testdata.Files,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		err = ValidateQueries(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	{
+		db, err := Connect(ConnectOptions{
+			Connect: "sqlite3://:memory:",
+			Files: fstest.MapFS{
+				"schema.sql":            {Data: []byte("select 1")},
+				"query/ok.sql":          {Data: []byte("select 1")},
+				"query/ok_test.sql":     {Data: []byte("-- want")},
+				"query/pg-postgres.sql": {Data: []byte("select 1")},
+				"query/bad.gotxt":       {Data: []byte("select {%if%}")},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		err = ValidateQueries(db)
+		if !ztest.ErrorContains(err, "1 errors") || !ztest.ErrorContains(err, "bad.gotxt") || ztest.ErrorContains(err, "queryTemplate") {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+}
@@ -1,13 +1,21 @@
 package zdb
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"io"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 )
 
 type logDB struct {
@@ -15,6 +23,7 @@ type logDB struct {
 	out     io.Writer
 	logWhat DumpArg
 	filter  string
+	redact  Redact
 }
 
 // NewLogDB returns a DB wrapper to log queries, query plans, and query results.
@@ -28,20 +37,25 @@ type logDB struct {
 //
 // Only LogQuery will be set if opts is nil,
 //
-// WARNING: printing the result means the query will be run twice, which is a
-// significant performance impact and DATA MODIFICATION STATEMENTS ARE ALSO RUN
-// TWICE. Some SQL engines may also run the query on EXPLAIN (e.g. PostgreSQL
-// does).
+// Parameters and columns with a name matching any of the redact patterns are
+// shown as [redacted]; see Redact.
 //
+// See NewStructuredLogDB() to log to a structured logger.
 //
-func NewLogDB(db DB, out io.Writer, logWhat DumpArg, filter string) DB {
+// WARNING: printing the result means the query will be run twice, which is a
+// significant performance impact. Queries that modify data (or anything that
+// isn't recognized as a select) are never run twice: the result from the
+// original query is logged instead, and EXPLAIN is used instead of EXPLAIN
+// ANALYZE on PostgreSQL. For Query() the rows are logged when they're closed,
+// and only the rows that were read are logged.
+func NewLogDB(db DB, out io.Writer, logWhat DumpArg, filter string, redact ...string) DB {
 	if logWhat == 0 {
 		logWhat = DumpQuery
 	}
 	if logWhat == DumpAll {
 		logWhat = DumpQuery | DumpExplain | DumpResult
 	}
-	return &logDB{DB: db, out: out, logWhat: logWhat | DumpLocation | dumpFromLogDB, filter: filter}
+	return &logDB{DB: db, out: out, logWhat: logWhat | DumpLocation | dumpFromLogDB, filter: filter, redact: redact}
 }
 
 func (d logDB) Unwrap() DB { return d.DB }
@@ -51,38 +65,246 @@ func (d logDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB
 	if err != nil {
 		return nil, nil, err
 	}
-	ldb := &logDB{DB: tx, out: d.out, logWhat: d.logWhat, filter: d.filter}
+	ldb := &logDB{DB: tx, out: d.out, logWhat: d.logWhat, filter: d.filter, redact: d.redact}
 	return WithDB(ctx, ldb), ldb, nil
 }
 
-func (d logDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
-	defer d.log(ctx, query, params)()
+func (d logDB) ExecContext(ctx context.Context, query string, params ...interface{}) (r sql.Result, err error) {
+	defer d.log(ctx, query, params, func() string {
+		if err != nil {
+			return err.Error()
+		}
+		n, _ := r.RowsAffected()
+		return fmt.Sprintf("%d rows affected", n)
+	})()
 	return d.DB.(dbImpl).ExecContext(ctx, query, params...)
 }
-func (d logDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
-	defer d.log(ctx, query, params)()
+func (d logDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) (err error) {
+	defer d.log(ctx, query, params, func() string { return destResult(dest, err, d.redact) })()
 	return d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
 }
-func (d logDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
-	defer d.log(ctx, query, params)()
+func (d logDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) (err error) {
+	defer d.log(ctx, query, params, func() string { return destResult(dest, err, d.redact) })()
 	return d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
 }
 func (d logDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
-	defer d.log(ctx, query, params)()
+	defer d.log(ctx, query, params, nil)()
 	return d.DB.(dbImpl).QueryxContext(ctx, query, params...)
 }
 
-func (d logDB) log(ctx context.Context, query string, params []interface{}) func() {
+func (d logDB) match(query string) bool {
+	return d.filter == "" || strings.Contains(reNormSpace.ReplaceAllString(query, " "), d.filter)
+}
+
+// Queries that modify data are never run again for EXPLAIN or the result; the
+// result is taken from the original query instead. For Query() the rows are
+// logged once they're closed; see teeRows().
+func (d logDB) log(ctx context.Context, query string, params []interface{}, result func() string) func() {
 	if _, ok := GetDB(ctx); !ok {
 		return func() {}
 	}
-
-	if d.filter != "" &&
-		!strings.Contains(regexp.MustCompile(`\s+`).ReplaceAllString(query, " "), d.filter) {
+	if !d.match(query) {
 		return func() {}
 	}
 
 	return func() {
-		Dump(WithDB(ctx, Unwrap(MustGetDB(ctx))), d.out, query, append(params, d.logWhat)...)
+		args := append(append(make([]interface{}, 0, len(params)+3), params...), d.logWhat, d.redact)
+		if isWrite(query) {
+			f := dumpFromLog{write: true}
+			if d.logWhat.has(DumpResult) {
+				if result == nil {
+					return
+				}
+				r := result()
+				f.result = &r
+			}
+			args = append(args, f)
+		}
+		Dump(WithDB(ctx, Unwrap(MustGetDB(ctx))), d.out, query, args...)
+	}
+}
+
+func (d logDB) teeRows(ctx context.Context, query string, params []interface{}) func([]string, [][]interface{}) {
+	if !d.logWhat.has(DumpResult) || !isWrite(query) || !d.match(query) {
+		return nil
+	}
+	loc := callerLoc()
+	return func(cols []string, rows [][]interface{}) {
+		d.redact.rows(cols, rows)
+		buf := new(bytes.Buffer)
+		err := writeHorizontal(buf, cols, rows)
+		r := buf.String()
+		if err != nil {
+			r = err.Error()
+		}
+		args := append(append(make([]interface{}, 0, len(params)+3), params...),
+			d.logWhat, d.redact, dumpFromLog{write: true, loc: loc, result: &r})
+		Dump(WithDB(ctx, Unwrap(MustGetDB(ctx))), d.out, query, args...)
+	}
+}
+
+// Internal parameter for Dump() from LogDB.
+type dumpFromLog struct {
+	write  bool    // Query modifies data; don't run it again.
+	plan   bool    // Never run the query again for EXPLAIN.
+	loc    string  // Location to use instead of zdebug.Loc().
+	result *string // Result of the original query.
+}
+
+// Get the tee function for Query() from the first LogDB that wants it.
+func teeRows(ctx context.Context, db DB, query string, params []interface{}) func([]string, [][]interface{}) {
+	for {
+		if l, ok := db.(interface {
+			teeRows(context.Context, string, []interface{}) func([]string, [][]interface{})
+		}); ok {
+			return l.teeRows(ctx, query, params)
+		}
+		uw, ok := db.(interface{ Unwrap() DB })
+		if !ok {
+			return nil
+		}
+		db = uw.Unwrap()
+	}
+}
+
+var reWrite = regexp.MustCompile(`(?i)\b(insert|update|delete|merge|replace)\b`)
+
+// Report if this query may modify data. Anything we don't know is assumed to
+// be a write.
+func isWrite(query string) bool {
+	query, ok := trimComments(query)
+	if !ok {
+		return true
+	}
+	switch firstWord(query) {
+	case "select", "values", "table", "show", "describe", "desc":
+		return false
+	case "with":
+		return reWrite.MatchString(query)
+	case "explain":
+		return strings.Contains(strings.ToLower(query), "analyze")
+	}
+	return true
+}
+
+// Remove leading whitespace and comments; returns false if there is an
+// unterminated comment.
+func trimComments(query string) (string, bool) {
+	query = strings.TrimSpace(query)
+	for {
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			i := strings.Index(query, "*/")
+			if i == -1 {
+				return "", false
+			}
+			query = strings.TrimSpace(query[i+2:])
+		case strings.HasPrefix(query, "--"):
+			i := strings.IndexByte(query, '\n')
+			if i == -1 {
+				return "", false
+			}
+			query = strings.TrimSpace(query[i+1:])
+		default:
+			return query, true
+		}
+	}
+}
+
+// Get the first word of the query in lower case.
+func firstWord(query string) string {
+	word := strings.ToLower(strings.TrimLeft(query, "("))
+	if i := strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }); i > -1 {
+		word = word[:i]
+	}
+	return word
+}
+
+// Format the result of Get() or Select() as a table.
+func destResult(dest interface{}, err error, red Redact) string {
+	if err != nil {
+		return err.Error()
+	}
+	cols, rows := destRows(dest)
+	red.rows(cols, rows)
+	buf := new(bytes.Buffer)
+	err = writeHorizontal(buf, cols, rows)
+	if err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+func destRows(dest interface{}) ([]string, [][]interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(dest))
+	elems := []reflect.Value{v}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		elems = make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, reflect.Indirect(v.Index(i)))
+		}
+	}
+	if len(elems) == 0 {
+		return []string{"(no rows)"}, nil
+	}
+
+	var (
+		t    = elems[0].Type()
+		cols []string
+		rows = make([][]interface{}, 0, len(elems))
+	)
+	switch {
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		for _, k := range elems[0].MapKeys() {
+			cols = append(cols, k.String())
+		}
+		sort.Strings(cols)
+		for _, e := range elems {
+			row := make([]interface{}, 0, len(cols))
+			for _, c := range cols {
+				row = append(row, e.MapIndex(reflect.ValueOf(c).Convert(t.Key())).Interface())
+			}
+			rows = append(rows, row)
+		}
+	case t.Kind() == reflect.Struct && !isScalar(t):
+		var fields []*reflectx.FieldInfo
+		for _, fi := range reflectx.NewMapperFunc("db", sqlx.NameMapper).TypeMap(t).Index {
+			if fi.Name == "" || fi.Embedded || inScalar(fi) ||
+				(fi.Field.Type.Kind() == reflect.Struct && !isScalar(fi.Field.Type)) {
+				continue
+			}
+			fields = append(fields, fi)
+			cols = append(cols, fi.Path)
+		}
+		for _, e := range elems {
+			row := make([]interface{}, 0, len(fields))
+			for _, fi := range fields {
+				row = append(row, reflectx.FieldByIndexesReadOnly(e, fi.Index).Interface())
+			}
+			rows = append(rows, row)
+		}
+	default:
+		cols = []string{"value"}
+		for _, e := range elems {
+			rows = append(rows, []interface{}{e.Interface()})
+		}
+	}
+	return cols, rows
+}
+
+// Report if this type is scanned as a single value, rather than a struct.
+func isScalar(t reflect.Type) bool {
+	return t == reflect.TypeOf(time.Time{}) ||
+		reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) ||
+		t.Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem())
+}
+
+// Report if this field is inside a struct that's scanned as a single value.
+func inScalar(fi *reflectx.FieldInfo) bool {
+	for p := fi.Parent; p != nil && p.Field.Type != nil; p = p.Parent {
+		if isScalar(p.Field.Type) {
+			return true
+		}
 	}
+	return false
 }
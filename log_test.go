@@ -3,6 +3,7 @@ package zdb
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -22,20 +23,15 @@ func TestLogDB(t *testing.T) {
 		{"all", DumpAll},
 	}
 
-	ctx := StartTest(t)
-
-	err := Exec(ctx, `create table x (i int); insert into x values (1), (2), (3), (4), (5)`)
-	if err != nil {
-		t.Fatal(err)
-	}
+	ctx := startWrapTest(t, 5)
 
 	for _, tt := range tests {
 		t.Run(tt.file, func(t *testing.T) {
 			buf := new(bytes.Buffer)
-			ctx = WithDB(context.Background(), NewLogDB(Unwrap(MustGetDB(ctx)), buf, tt.opts, ""))
+			ctx := wrapDB(ctx, func(db DB) DB { return NewLogDB(db, buf, tt.opts, "") })
 
 			var i, j int
-			err = Get(ctx, &i, `select i from x where i<3`)
+			err := Get(ctx, &i, `select i from x where i<3`)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -62,3 +58,140 @@ func TestLogDB(t *testing.T) {
 		})
 	}
 }
+
+func TestLogDBWrites(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table x (i int, s varchar(10))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	lctx := wrapDB(ctx, func(db DB) DB { return NewLogDB(db, buf, DumpAll, "") })
+
+	t.Run("exec", func(t *testing.T) {
+		buf.Reset()
+		err := Exec(lctx, `insert into x values (1, 'a'), (2, 'b')`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var n int
+		err = Get(ctx, &n, `select count(*) from x`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("inserted %d rows", n)
+		}
+		if out := buf.String(); !strings.Contains(out, "2 rows affected") || !strings.Contains(out, "EXPLAIN") {
+			t.Errorf("wrong output:\n%s", out)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		// Writes are never run again, so the rows are logged on Close().
+		// go-sqlite3 doesn't support returning yet, but pragma isn't
+		// recognized as a read either.
+		query, col, want := `insert into x values (3, 'c'), (4, 'd') returning i, s`, "s", "c d"
+		if Driver(ctx) == DriverSQLite {
+			query, col, want = `pragma table_info(x)`, "name", "i s"
+		}
+
+		buf.Reset()
+		rows, err := Query(lctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("logged before close:\n%s", buf.String())
+		}
+		var got []string
+		for rows.Next() {
+			// Scanning more than once should log the row only once.
+			var r map[string]interface{}
+			for i := 0; i < 2; i++ {
+				err := rows.Scan(&r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got = append(got, fmt.Sprintf("%s", r[col]))
+		}
+		err = rows.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(got, " ") != want {
+			t.Errorf("wrong rows: %v", got)
+		}
+		out := buf.String()
+		i := strings.Index(out, "RESULT")
+		if !strings.Contains(out, "log_test.go:") || i == -1 {
+			t.Fatalf("wrong output:\n%s", out)
+		}
+		if n := strings.Count(strings.TrimSpace(out[i:]), "\n"); n != 3 {
+			t.Errorf("wrong number of rows logged: %d\n%s", n-1, out)
+		}
+	})
+}
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`select 1`, false},
+		{"/* name */\n-- comment\n  SELECT * from x", false},
+		{`(select 1) union (select 2)`, false},
+		{`with x as (select 1) select * from x`, false},
+		{`values (1)`, false},
+		{`explain select 1`, false},
+
+		{`insert into x values (1)`, true},
+		{`Update x set i = 1`, true},
+		{`delete from x`, true},
+		{`with x as (delete from y returning *) select * from x`, true},
+		{`explain analyze delete from x`, true},
+		{`create table x (i int)`, true},
+		{`pragma foreign_keys = on`, true},
+		{`/* unterminated`, true},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			if have := isWrite(tt.query); have != tt.want {
+				t.Errorf("isWrite(%q) = %t", tt.query, have)
+			}
+		})
+	}
+}
+
+func TestDestResult(t *testing.T) {
+	type row struct {
+		ID   int     `db:"id"`
+		Name *string `db:"name"`
+		Skip string  `db:"-"`
+	}
+	name := "x"
+	tests := []struct {
+		dest interface{}
+		want string
+	}{
+		{&[]row{{ID: 1, Name: &name}, {ID: 2}}, "id  name\n1   x\n2   NULL\n"},
+		{&row{ID: 1}, "id  name\n1   NULL\n"},
+		{&[]*row{}, "(no rows)\n"},
+		{new(int64), "value\n0\n"},
+		{&[]string{"a", "b"}, "value\na\nb\n"},
+		{&map[string]interface{}{"b": 2, "a": 1}, "a   b\n1   2\n"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := destResult(tt.dest, nil, nil)
+			if have != tt.want {
+				t.Errorf("\nhave:\n%s\nwant:\n%s", have, tt.want)
+			}
+		})
+	}
+}
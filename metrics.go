@@ -0,0 +1,293 @@
+package zdb
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Metrics collects statistics for queries; see NewMetricsDB().
+//
+// Metrics implements http.Handler to write the statistics in the Prometheus
+// text format.
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[string]*queryMetric
+}
+
+// QueryStats are statistics for a single query.
+type QueryStats struct {
+	Query  string // Query name, or normalized query if it has no name.
+	Count  int64  // Number of times the query was run.
+	Errors int64  // Number of errors; sql.ErrNoRows isn't counted as an error.
+	Rows   int64  // Number of rows returned or affected; for Query() the rows read are added on Close().
+
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	P95   time.Duration // 95th percentile of the last 1024 runs.
+}
+
+// Number of durations to keep for calculating the percentile.
+const metricSamples = 1024
+
+// Maximum number of queries to keep statistics for; queries after that are
+// grouped as metricOther.
+const (
+	metricMaxQueries = 1000
+	metricOther      = "[other]"
+)
+
+type queryMetric struct {
+	QueryStats
+	samples []time.Duration // Ring buffer.
+	next    int
+}
+
+type metricsDB struct {
+	DB
+	m *Metrics
+}
+
+// NewMetricsDB returns a DB wrapper which collects statistics for every query,
+// similar to PostgreSQL's pg_stat_statements but for all drivers.
+//
+// Statistics are grouped by the query name from Load() (the /* name */
+// comment at the start of the query); queries without a name are grouped by a
+// normalized version of the query, with all literals and placeholders
+// replaced by "?". Statistics are kept for at most 1,000 different queries;
+// any queries after that are grouped as "[other]", so building queries
+// dynamically won't use unbounded memory.
+func NewMetricsDB(db DB) (DB, *Metrics) {
+	m := &Metrics{stats: make(map[string]*queryMetric)}
+	return &metricsDB{DB: db, m: m}, m
+}
+
+func (d metricsDB) Unwrap() DB { return d.DB }
+
+func (d metricsDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
+	ctx, tx, err := d.DB.Begin(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	mdb := &metricsDB{DB: tx, m: d.m}
+	return WithDB(ctx, mdb), mdb, nil
+}
+
+func (d metricsDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).ExecContext(ctx, query, params...)
+	var n int64
+	if err == nil {
+		n, _ = r.RowsAffected()
+	}
+	d.m.record(query, time.Since(start), n, err)
+	return r, err
+}
+func (d metricsDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
+	var n int64
+	if err == nil {
+		n = 1
+	}
+	d.m.record(query, time.Since(start), n, err)
+	return err
+}
+func (d metricsDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
+	var n int64
+	if err == nil {
+		if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+			n = int64(v.Len())
+		}
+	}
+	d.m.record(query, time.Since(start), n, err)
+	return err
+}
+func (d metricsDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).QueryxContext(ctx, query, params...)
+	d.m.record(query, time.Since(start), 0, err)
+	return r, err
+}
+
+// The rows are read after QueryxContext() returns; add them once the rows are
+// closed.
+func (d metricsDB) countRows(query string) func(int64) {
+	return func(n int64) { d.m.addRows(query, n) }
+}
+
+func (m *Metrics) record(query string, took time.Duration, rows int64, err error) {
+	name := queryName(query)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.stats[name]; !ok && len(m.stats) >= metricMaxQueries {
+		name = metricOther
+	}
+	s, ok := m.stats[name]
+	if !ok {
+		s = &queryMetric{QueryStats: QueryStats{Query: name, Min: took}}
+		m.stats[name] = s
+	}
+	s.Count++
+	s.Rows += rows
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.Errors++
+	}
+	s.Total += took
+	if took < s.Min {
+		s.Min = took
+	}
+	if took > s.Max {
+		s.Max = took
+	}
+	if len(s.samples) < metricSamples {
+		s.samples = append(s.samples, took)
+	} else {
+		s.samples[s.next] = took
+		s.next = (s.next + 1) % metricSamples
+	}
+}
+
+func (m *Metrics) addRows(query string, rows int64) {
+	name := queryName(query)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[name]
+	if !ok {
+		// Grouped as metricOther, or removed with Reset().
+		if s, ok = m.stats[metricOther]; !ok {
+			return
+		}
+	}
+	s.Rows += rows
+}
+
+// Stats gets a snapshot of the statistics for all queries, sorted by the total
+// time (highest first).
+func (m *Metrics) Stats() []QueryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]QueryStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		st := s.QueryStats
+		if len(s.samples) > 0 {
+			sorted := append([]time.Duration(nil), s.samples...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			st.P95 = sorted[(len(sorted)*95+99)/100-1]
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total == stats[j].Total {
+			return stats[i].Query < stats[j].Query
+		}
+		return stats[i].Total > stats[j].Total
+	})
+	return stats
+}
+
+// Reset all statistics.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = make(map[string]*queryMetric)
+}
+
+// ServeHTTP writes the statistics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	var (
+		stats = m.Stats()
+		b     = bufio.NewWriter(w)
+		sec   = func(d time.Duration) string { return fmt.Sprintf("%g", d.Seconds()) }
+	)
+	metric := func(name, typ, help string, value func(QueryStats) string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, s := range stats {
+			fmt.Fprintf(b, "%s{query=\"%s\"} %s\n", name, promLabel(s.Query), value(s))
+		}
+	}
+
+	metric("zdb_queries_total", "counter", "Number of queries.",
+		func(s QueryStats) string { return fmt.Sprintf("%d", s.Count) })
+	metric("zdb_query_errors_total", "counter", "Number of queries that returned an error.",
+		func(s QueryStats) string { return fmt.Sprintf("%d", s.Errors) })
+	metric("zdb_query_rows_total", "counter", "Number of rows returned or affected.",
+		func(s QueryStats) string { return fmt.Sprintf("%d", s.Rows) })
+	metric("zdb_query_duration_min_seconds", "gauge", "Shortest query duration.",
+		func(s QueryStats) string { return sec(s.Min) })
+	metric("zdb_query_duration_max_seconds", "gauge", "Longest query duration.",
+		func(s QueryStats) string { return sec(s.Max) })
+
+	fmt.Fprint(b, "# HELP zdb_query_duration_seconds Query duration.\n# TYPE zdb_query_duration_seconds summary\n")
+	for _, s := range stats {
+		l := promLabel(s.Query)
+		fmt.Fprintf(b, "zdb_query_duration_seconds{query=\"%s\",quantile=\"0.95\"} %s\n", l, sec(s.P95))
+		fmt.Fprintf(b, "zdb_query_duration_seconds_sum{query=\"%s\"} %s\n", l, sec(s.Total))
+		fmt.Fprintf(b, "zdb_query_duration_seconds_count{query=\"%s\"} %d\n", l, s.Count)
+	}
+	b.Flush()
+}
+
+func promLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Get the function to count the rows for Query() from the first MetricsDB.
+func countRows(db DB, query string) func(int64) {
+	for {
+		if m, ok := db.(interface{ countRows(string) func(int64) }); ok {
+			return m.countRows(query)
+		}
+		uw, ok := db.(interface{ Unwrap() DB })
+		if !ok {
+			return nil
+		}
+		db = uw.Unwrap()
+	}
+}
+
+var (
+	reNormString = regexp.MustCompile(`'(?:[^']|'')*'`)
+	reNormNumber = regexp.MustCompile(`\b\d+(?:\.\d+)?\b|\$\d+`)
+	reNormList   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	reNormSpace  = regexp.MustCompile(`\s+`)
+)
+
+// Get the name from the /* name */ comment Load() adds, or a normalized
+// version of the query if there is none.
+func queryName(query string) string {
+	if name := loadName(query); name != "" {
+		return name
+	}
+	return normalizeQuery(query)
+}
+
+// Normalize a query by replacing all literals and placeholders with ?, and
+// lists of them ("in (1, 2, 3)") with a single (?).
+func normalizeQuery(query string) string {
+	query = reNormString.ReplaceAllString(query, "?")
+	query = reNormNumber.ReplaceAllString(query, "?")
+	query = reNormList.ReplaceAllString(query, "(?)")
+	return strings.TrimSpace(reNormSpace.ReplaceAllString(query, " "))
+}
@@ -0,0 +1,131 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsDB(t *testing.T) {
+	ctx := startWrapTest(t, 3)
+
+	var m *Metrics
+	ctx = wrapDB(ctx, func(db DB) DB {
+		mdb, mm := NewMetricsDB(db)
+		m = mm
+		return mdb
+	})
+
+	for _, i := range []int{1, 2, 3, 4} {
+		var r []struct{ I int }
+		err := Select(ctx, &r, `select i from x where i >= ?`, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := TX(ctx, func(ctx context.Context) error {
+		return Exec(ctx, "/* update-x */\nupdate x set i = i + 1 where i > :i", P{"i": 1})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Exec(ctx, `select nonexistent from x`)
+	if err == nil {
+		t.Fatal("no error")
+	}
+
+	rows, err := Query(ctx, `select i from x where i < ?`, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := make(map[string]QueryStats)
+	for _, s := range m.Stats() {
+		stats[s.Query] = s
+		if s.Min > s.Max || s.P95 < s.Min || s.P95 > s.Max || s.Total < s.Max {
+			t.Errorf("wrong durations: %+v", s)
+		}
+	}
+
+	if s := stats["select i from x where i >= ?"]; s.Count != 4 || s.Rows != 6 || s.Errors != 0 {
+		t.Errorf("select: %+v", s)
+	}
+	if s := stats["update-x"]; s.Count != 1 || s.Rows != 2 || s.Errors != 0 {
+		t.Errorf("update: %+v", s)
+	}
+	if s := stats["select nonexistent from x"]; s.Count != 1 || s.Errors != 1 {
+		t.Errorf("error: %+v", s)
+	}
+	if s := stats["select i from x where i < ?"]; s.Count != 1 || s.Rows != 3 || s.Errors != 0 {
+		t.Errorf("query: %+v", s)
+	}
+
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE zdb_queries_total counter\n",
+		`zdb_queries_total{query="select i from x where i >= ?"} 4` + "\n",
+		`zdb_query_rows_total{query="update-x"} 2` + "\n",
+		`zdb_query_errors_total{query="select nonexistent from x"} 1` + "\n",
+		`zdb_query_duration_seconds_count{query="update-x"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q not in:\n%s", want, body)
+		}
+	}
+
+	m.Reset()
+	if s := m.Stats(); len(s) != 0 {
+		t.Errorf("not reset: %v", s)
+	}
+}
+
+func TestMetricsMax(t *testing.T) {
+	_, m := NewMetricsDB(nil)
+	for i := 0; i < metricMaxQueries+10; i++ {
+		m.record(fmt.Sprintf("select c%d from x", i), time.Millisecond, 1, nil)
+	}
+	m.record("select c0 from x", time.Millisecond, 1, nil)
+
+	stats := make(map[string]QueryStats)
+	for _, s := range m.Stats() {
+		stats[s.Query] = s
+	}
+	if len(stats) != metricMaxQueries+1 {
+		t.Errorf("len = %d", len(stats))
+	}
+	if s := stats[metricOther]; s.Count != 10 || s.Rows != 10 {
+		t.Errorf("other: %+v", s)
+	}
+	if s := stats["select c0 from x"]; s.Count != 2 {
+		t.Errorf("existing: %+v", s)
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"select 1", "select ?"},
+		{"select * from t where a = 'x''y' and b = $1", "select * from t where a = ? and b = ?"},
+		{"select * from t2\n\twhere id in (1, 2,3) and x = 1.5", "select * from t2 where id in (?) and x = ?"},
+		{"/* name */\nselect 1", "name"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := queryName(tt.in)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
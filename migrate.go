@@ -19,6 +19,7 @@ type Migrate struct {
 	gomig map[string]func(context.Context) error
 	log   func(name string)
 	test  bool
+	data  interface{}
 }
 
 // NewMigrate creates a new migration instance.
@@ -48,6 +49,9 @@ func NewMigrate(db DB, files fs.FS, gomig map[string]func(context.Context) error
 // This only gets called if the migration was run successfully.
 func (m *Migrate) Log(f func(name string)) { m.log = f }
 
+// TemplateData sets the data passed to .gotxt migrations; see SchemaTemplateData.
+func (m *Migrate) TemplateData(data interface{}) { m.data = data }
+
 // Test sets the "test" flag: it won't commit any transactions.
 //
 // This will work correctly for SQLite and PostgreSQL, but not MariaDB as most
@@ -69,20 +73,14 @@ func (m Migrate) List() (haveMig, ranMig []string, err error) {
 			continue
 		}
 
-		isFor := DriverUnknown
-		if zstring.HasSuffixes(f.Name(), "-postgres.sql", "-postgresql.sql") {
-			isFor = DriverPostgreSQL
-		} else if zstring.HasSuffixes(f.Name(), "-sqlite3.sql", "-sqlite.sql") {
-			isFor = DriverSQLite
-		} else if zstring.HasSuffixes(f.Name(), "-mariadb.sql") {
-			isFor = DriverMariaDB
-		}
+		isFor, name := fileDriver(f.Name())
 		if isFor != DriverUnknown && isFor != driver {
 			continue
 		}
-
-		haveMig = append(haveMig, zstring.TrimSuffixes(f.Name(), ".sql", ".gotxt",
-			"-postgres", "-postgresql", "-sqlite3", "-sqlite", "-mariadb"))
+		if strings.HasSuffix(name, ".down") { // Run with Down(), not a migration.
+			continue
+		}
+		haveMig = append(haveMig, name)
 	}
 	for k := range m.gomig {
 		haveMig = append(haveMig, k)
@@ -109,7 +107,7 @@ func (m Migrate) Schema(name string) (string, error) {
 	}
 
 	if strings.HasSuffix(file, ".gotxt") {
-		b, err = SchemaTemplate(m.db.Driver(), string(b))
+		b, err = SchemaTemplateData(m.db.Driver(), string(b), m.data)
 		if err != nil {
 			return "", err
 		}
@@ -218,6 +216,63 @@ func (m Migrate) Run(which ...string) error {
 	return nil
 }
 
+// Down reverts a migration that was previously run.
+//
+// This runs the "down" file for the migration: migrate/{name}.down.sql,
+// migrate/{name}.down-{driver}.sql, or migrate/{name}.down.gotxt, and removes
+// the entry from the version table. It's an error if the migration was never
+// run or if there is no down file. Go migrations can't be reverted.
+func (m Migrate) Down(name string) error {
+	name = zstring.TrimSuffixes(name, ".sql", ".gotxt")
+	if m.findGoMig(name) != nil {
+		return fmt.Errorf("zdb.Migrate.Down: %q is a Go migration", name)
+	}
+
+	_, ranMig, err := m.List()
+	if err != nil {
+		return fmt.Errorf("zdb.Migrate.Down: %w", err)
+	}
+	if !zstring.Contains(ranMig, name) {
+		return fmt.Errorf("zdb.Migrate.Down: migration not run: %q", name)
+	}
+
+	s, err := m.Schema(name + ".down")
+	if err != nil {
+		return fmt.Errorf("zdb.Migrate.Down: %q: %w", name, err)
+	}
+
+	if m.log != nil {
+		msg := name + " (down)"
+		if m.test {
+			msg += " (test mode; not committing)"
+		}
+		m.log(msg)
+	}
+
+	ctx, tx, err := m.db.Begin(WithDB(context.Background(), m.db))
+	if err != nil {
+		return fmt.Errorf("zdb.Migrate.Down: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = Exec(ctx, s)
+	if err != nil {
+		return fmt.Errorf("zdb.Migrate.Down: running %q: %w", name, err)
+	}
+	err = Exec(ctx, `delete from version where name=?`, name)
+	if err != nil {
+		return fmt.Errorf("zdb.Migrate.Down: running %q: %w", name, err)
+	}
+
+	if !m.test {
+		err := tx.Commit()
+		if err != nil {
+			return fmt.Errorf("zdb.Migrate.Down: running %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func (m Migrate) findGoMig(name string) func(context.Context) error {
 	for k, f := range m.gomig {
 		if k == name {
@@ -3,8 +3,10 @@ package zdb
 import (
 	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"zgo.at/zdb/testdata"
+	"zgo.at/zstd/ztest"
 )
 
 func TestMigrateList(t *testing.T) {
@@ -66,3 +68,87 @@ func TestMigrateList(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrateListDriver(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table version (name varchar)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		suffix string
+		driver DriverType
+	}{
+		{"-sqlite", DriverSQLite},
+		{"-sqlite3", DriverSQLite},
+		{"-postgres", DriverPostgreSQL},
+		{"-postgresql", DriverPostgreSQL},
+		{"-psql", DriverPostgreSQL},
+		{"-mariadb", DriverMariaDB},
+		{"-mysql", DriverMariaDB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suffix, func(t *testing.T) {
+			m, err := NewMigrate(MustGetDB(ctx), fstest.MapFS{
+				"1-one.sql":                         {},
+				"1-one.down" + tt.suffix + ".sql":   {},
+				"2-two" + tt.suffix + ".sql":        {},
+				"2-two.down" + tt.suffix + ".sql":   {},
+				"3-three.gotxt":                     {},
+				"3-three.down" + tt.suffix + ".sql": {},
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, _, err := m.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"1-one", "3-three"}
+			if Driver(ctx) == tt.driver {
+				want = []string{"1-one", "2-two", "3-three"}
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+			}
+		})
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table version (name varchar)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Exec(ctx, `insert into version (name) values ('test')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMigrate(MustGetDB(ctx), testdata.Files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Down("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ran, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("ran not empty: %#v", ran)
+	}
+
+	err = m.Down("test")
+	if !ztest.ErrorContains(err, "migration not run") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package zdb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// compileNamed replaces all :name parameters in the query with ?, and returns
+// the parameter names in the order they appear and the byte offsets of the ?
+// placeholders in the new query.
+//
+// This is similar to sqlx.Named(), except that:
+//
+//   - "::" is left alone, so PostgreSQL casts such as :start::timestamp work.
+//   - Parameters in string literals, quoted identifiers, and comments are
+//     ignored.
+//   - Names must start with a letter or underscore, so array slices like
+//     arr[1:2] aren't seen as a parameter.
+func compileNamed(driver DriverType, query string) (string, []string, []int) {
+	var (
+		b     strings.Builder
+		names []string
+		pos   []int
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		if e := skipLiteral(driver, query, i); e > i {
+			b.WriteString(query[i:e])
+			i = e
+			continue
+		}
+
+		switch c := query[i]; {
+		case strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			e := i + 1
+			for e < len(query) && isNameChar(query[e]) {
+				e++
+			}
+			names = append(names, query[i+1:e])
+			pos = append(pos, b.Len())
+			b.WriteByte('?')
+			i = e
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), names, pos
+}
+
+// findPlaceholders gets the byte offsets of all ? placeholders in the query,
+// ignoring string literals, quoted identifiers, and comments.
+func findPlaceholders(driver DriverType, query string) []int {
+	var pos []int
+	for i := 0; i < len(query); {
+		if e := skipLiteral(driver, query, i); e > i {
+			i = e
+			continue
+		}
+		if query[i] == '?' {
+			pos = append(pos, i)
+		}
+		i++
+	}
+	return pos
+}
+
+// Get the end of the string literal, quoted identifier, or comment starting at
+// i; returns i if there isn't one.
+func skipLiteral(driver DriverType, query string, i int) int {
+	c := query[i]
+	switch {
+	case c == '\'' || c == '"' || c == '`':
+		return skipQuoted(driver, query, i)
+	case strings.HasPrefix(query[i:], "--") || (c == '#' && driver == DriverMariaDB):
+		e := strings.IndexByte(query[i:], '\n')
+		if e == -1 {
+			return len(query)
+		}
+		return e + i
+	case strings.HasPrefix(query[i:], "/*"):
+		e := strings.Index(query[i+2:], "*/")
+		if e == -1 {
+			return len(query)
+		}
+		return e + i + 4
+	case c == '$' && driver == DriverPostgreSQL:
+		if e := skipDollarQuoted(query, i); e > i+1 {
+			return e
+		}
+	}
+	return i
+}
+
+// splice replaces query[start:end] with repl, and moves the placeholder
+// offsets in pos after it.
+func splice(query string, pos []int, start, end int, repl string) string {
+	d := len(repl) - (end - start)
+	for k := range pos {
+		if pos[k] >= end {
+			pos[k] += d
+		}
+	}
+	return query[:start] + repl + query[end:]
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Get the end of the quoted string or identifier starting at i.
+//
+// Quotes are escaped by doubling them; MariaDB and PostgreSQL E'..' strings
+// also allow backslash escapes.
+func skipQuoted(driver DriverType, query string, i int) int {
+	q := query[i]
+	backslash := q == '\'' && (driver == DriverMariaDB ||
+		(driver == DriverPostgreSQL && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e')))
+	for j := i + 1; j < len(query); j++ {
+		switch {
+		case backslash && query[j] == '\\':
+			j++
+		case query[j] == q:
+			if j+1 < len(query) && query[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+// Get the end of the PostgreSQL dollar-quoted string starting at i, such as
+// $$..$$ or $fn$..$fn$. This returns i+1 if it's not a dollar-quoted string
+// (e.g. $1).
+func skipDollarQuoted(query string, i int) int {
+	j := i + 1
+	for j < len(query) && (isNameStart(query[j]) || (j > i+1 && query[j] >= '0' && query[j] <= '9')) {
+		j++
+	}
+	if j >= len(query) || query[j] != '$' {
+		return i + 1
+	}
+	tag := query[i : j+1]
+	e := strings.Index(query[j+1:], tag)
+	if e == -1 {
+		return len(query)
+	}
+	return j + 1 + e + len(tag)
+}
+
+// bindNamed gets the values for the named parameters from the map.
+func bindNamed(names []string, params map[string]interface{}) ([]interface{}, error) {
+	var (
+		vals    = make([]interface{}, 0, len(names))
+		missing []string
+	)
+	for _, n := range names {
+		v, ok := params[n]
+		if !ok {
+			missing = append(missing, n)
+			continue
+		}
+		vals = append(vals, v)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing parameters: %s", quoteNames(missing))
+	}
+	return vals, nil
+}
+
+// unusedParams gets all keys in the map parameters that aren't used as a
+// parameter in the query or in a conditional.
+//
+// Struct fields are never reported, as it's common to pass a struct with more
+// fields than are used.
+func unusedParams(driver DriverType, query string, params []interface{}) error {
+	used := make(map[string]struct{})
+	_, names, _ := compileNamed(driver, query)
+	for _, n := range append(names, conditionalNames(query)...) {
+		used[n] = struct{}{}
+	}
+
+	var unused []string
+	for _, p := range params {
+		m, ok := toParamMap(p)
+		if !ok {
+			continue
+		}
+		for k := range m {
+			if _, ok := used[k]; !ok {
+				unused = append(unused, k)
+			}
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return fmt.Errorf("unused parameters: %s", quoteNames(unused))
+	}
+	return nil
+}
+
+// conditionalNames gets all the parameter names used in {{:cond ..}}
+// conditionals, including nested ones.
+func conditionalNames(query string) []string {
+	var names []string
+	for pos := 0; ; {
+		s := strings.Index(query[pos:], "{{:")
+		if s == -1 {
+			return names
+		}
+		pos += s + 3
+		cond, _, ok := splitConditional(query[pos:])
+		if !ok {
+			continue
+		}
+		for _, or := range strings.Split(cond, "||") {
+			for _, n := range strings.Split(or, "&&") {
+				names = append(names, strings.TrimSuffix(strings.TrimSpace(n), "!"))
+			}
+		}
+	}
+}
+
+// rebindNamed converts the ? placeholders at the offsets in pos to
+// PostgreSQL's $n, using the same $n for parameters with the same name. Every
+// placeholder gets a new $n if names is nil.
+//
+// This returns false if the number of placeholders doesn't match the
+// parameters.
+func rebindNamed(query string, pos []int, names []string, params []interface{}) (string, []interface{}, bool) {
+	if len(pos) != len(params) || (names != nil && len(names) != len(params)) {
+		return query, params, false
+	}
+
+	var (
+		b       strings.Builder
+		seen    = make(map[string]int, len(names))
+		nparams = make([]interface{}, 0, len(params))
+		last    int
+	)
+	b.Grow(len(query) + len(pos))
+	for k, i := range pos {
+		b.WriteString(query[last:i])
+		last = i + 1
+
+		n := -1
+		if names != nil {
+			n = seen[names[k]]
+		}
+		if n <= 0 {
+			nparams = append(nparams, params[k])
+			n = len(nparams)
+			if names != nil {
+				seen[names[k]] = n
+			}
+		}
+		fmt.Fprintf(&b, "$%d", n)
+	}
+	b.WriteString(query[last:])
+	return b.String(), nparams, true
+}
+
+// uniqNames removes repeated names, keeping the first; this matches the
+// parameters returned by rebindNamed().
+func uniqNames(names []string) []string {
+	var (
+		seen = make(map[string]struct{}, len(names))
+		uniq = make([]string, 0, len(names))
+	)
+	for _, n := range names {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		uniq = append(uniq, n)
+	}
+	return uniq
+}
+
+func toParamMap(param interface{}) (map[string]interface{}, bool) {
+	if param == nil {
+		return nil, false
+	}
+	var (
+		m = reflect.TypeOf(map[string]interface{}{})
+		v = reflect.ValueOf(param)
+	)
+	if v.Kind() != reflect.Map || !v.Type().ConvertibleTo(m) {
+		return nil, false
+	}
+	return v.Convert(m).Interface().(map[string]interface{}), true
+}
+
+func quoteNames(names []string) string {
+	q := make([]string, 0, len(names))
+	for _, n := range names {
+		q = append(q, fmt.Sprintf("%q", n))
+	}
+	return strings.Join(q, ", ")
+}
@@ -0,0 +1,111 @@
+package zdb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCompileNamed(t *testing.T) {
+	tests := []struct {
+		driver    DriverType
+		in        string
+		wantQuery string
+		wantNames []string
+	}{
+		{DriverSQLite, `select :x`, `select ?`, []string{"x"}},
+		{DriverSQLite, `select :a.b_c1, :_d`, `select ?, ?`, []string{"a.b_c1", "_d"}},
+		{DriverSQLite, `select :x, :x`, `select ?, ?`, []string{"x", "x"}},
+		{DriverPostgreSQL, `select :x::timestamp`, `select ?::timestamp`, []string{"x"}},
+		{DriverPostgreSQL, `select '::x'::text`, `select '::x'::text`, nil},
+		{DriverSQLite, `select 'a '' :x', "b "" :x", :y`, `select 'a '' :x', "b "" :x", ?`, []string{"y"}},
+		{DriverMariaDB, "select 'a \\' :x', `b :x`, :y", "select 'a \\' :x', `b :x`, ?", []string{"y"}},
+		{DriverMariaDB, "select :y # :x\n", "select ? # :x\n", []string{"y"}},
+		{DriverSQLite, "select :y # :x\n", "select ? # ?\n", []string{"y", "x"}},
+		{DriverPostgreSQL, `select E'\' :x', :y`, `select E'\' :x', ?`, []string{"y"}},
+		{DriverPostgreSQL, `select $$ :x $$, $fn$ :x $fn$, $1, :y`, `select $$ :x $$, $fn$ :x $fn$, $1, ?`, []string{"y"}},
+		{DriverSQLite, "select :y /* :x", "select ? /* :x", []string{"y"}},
+		{DriverSQLite, "select 'unterminated :x", "select 'unterminated :x", nil},
+		{DriverSQLite, `select time('12:30')`, `select time('12:30')`, nil},
+		{DriverSQLite, `select :`, `select :`, nil},
+		{DriverPostgreSQL, `select '?', data ? 'k', :x`, `select '?', data ? 'k', ?`, []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			query, names, pos := compileNamed(tt.driver, tt.in)
+			if query != tt.wantQuery {
+				t.Errorf("wrong query\nhave: %q\nwant: %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("wrong names\nhave: %q\nwant: %q", names, tt.wantNames)
+			}
+			if len(pos) != len(names) {
+				t.Fatalf("wrong pos: %v", pos)
+			}
+			for _, i := range pos {
+				if query[i] != '?' {
+					t.Errorf("not a placeholder at %d: %q", i, query[i:])
+				}
+			}
+		})
+	}
+}
+
+func TestFindPlaceholders(t *testing.T) {
+	tests := []struct {
+		driver DriverType
+		in     string
+		want   []int
+	}{
+		{DriverSQLite, `select ?`, []int{7}},
+		{DriverSQLite, `select '?', "?", ? -- ?`, []int{17}},
+		{DriverSQLite, `select ? /* ? */, ?`, []int{7, 18}},
+		{DriverMariaDB, "select `?`, ? # ?", []int{12}},
+		{DriverPostgreSQL, `select $$ ? $$, E'\' ?', ?`, []int{25}},
+		{DriverSQLite, `select 1`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have := findPlaceholders(tt.driver, tt.in)
+			if !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("\nhave: %v\nwant: %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebindNamed(t *testing.T) {
+	tests := []struct {
+		query  string
+		names  []string
+		params []interface{}
+		want   string
+	}{
+		{`select ?, ?, ?`, []string{"a", "b", "a"}, L{1, 2, 1}, `select $1, $2, $1 [1 2] true`},
+		{`select ?`, []string{"a"}, L{1}, `select $1 [1] true`},
+		{`select ?, ?`, []string{"a"}, L{1, 2}, `select ?, ? [1 2] false`},
+		{`select ?, ?`, []string{"a", "b"}, L{1, 2, 3}, `select ?, ? [1 2 3] false`},
+		{`select '?', ?, ?`, nil, L{1, 1}, `select '?', $1, $2 [1 1] true`},
+		{`select '?', ?, '?', ?`, []string{"a", "a"}, L{1, 1}, `select '?', $1, '?', $1 [1] true`},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			pos := findPlaceholders(DriverPostgreSQL, tt.query)
+			query, params, ok := rebindNamed(tt.query, pos, tt.names, tt.params)
+			have := fmt.Sprintf("%s %v %t", query, params, ok)
+			if have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyParamsRepeated(t *testing.T) {
+	have := ApplyParams(`select $1, $2, $1`, "a", 2)
+	if want := `select 'a', 2, 'a';`; have != want {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+}
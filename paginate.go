@@ -0,0 +1,285 @@
+package zdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Page is a page for Paginate().
+type Page struct {
+	// Cursor returned by the previous call to Paginate(); empty for the first
+	// page.
+	After string
+
+	// Number of rows per page.
+	Size int
+
+	// Columns to order by; these must be in the query's select list, and
+	// together need to be unique (e.g. "created_at", "id").
+	OrderBy []string
+
+	// Order in descending order, rather than ascending.
+	Desc bool
+}
+
+// Paginate selects one page of results from the query in to dest, using keyset
+// pagination ("where (a, b) > (?, ?)") rather than limit/offset.
+//
+// The returned cursor can be used as Page.After to get the next page; it's
+// empty if this is the last page. The cursor is an opaque URL-safe string, and
+// can be passed to clients. Values are always sent as parameters, so a
+// tampered cursor will give wrong results, but can't be used for SQL
+// injection.
+//
+//   var (
+//       users []User
+//       page  = zdb.Page{Size: 50, OrderBy: []string{"created_at", "user_id"}, After: r.FormValue("after")}
+//   )
+//   next, err := zdb.Paginate(ctx, &users, `select * from users where site_id = :site`, page, zdb.P{"site": site})
+//
+// The query is wrapped in a sub-query, so it shouldn't have its own order by
+// or limit. Columns in OrderBy can't be NULL, and must be in dest. Positional
+// parameters must use "?" placeholders, as the cursor values are added after
+// them.
+//
+// dest must be a pointer to a slice of structs (or pointers to structs).
+func Paginate(ctx context.Context, dest interface{}, query string, page Page, params ...interface{}) (string, error) {
+	db := MustGetDB(ctx)
+	if page.Size <= 0 {
+		return "", errors.New("zdb.Paginate: Page.Size must be larger than 0")
+	}
+	if len(page.OrderBy) == 0 {
+		return "", errors.New("zdb.Paginate: Page.OrderBy is empty")
+	}
+	for _, c := range page.OrderBy {
+		if !reIdent.MatchString(c) || strings.Contains(c, ".") {
+			return "", fmt.Errorf("zdb.Paginate: invalid column in OrderBy: %q", c)
+		}
+	}
+
+	// Check the columns before running anything, as some databases treat
+	// unknown quoted identifiers as strings.
+	t := reflect.TypeOf(dest)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return "", fmt.Errorf("zdb.Paginate: dest must be a pointer to a slice, not %s", t)
+	}
+	t = t.Elem().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("zdb.Paginate: dest must be a slice of structs, not %s", t)
+	}
+	tm := reflectx.NewMapperFunc("db", sqlx.NameMapper).TypeMap(t)
+	for _, c := range page.OrderBy {
+		if tm.GetByPath(c) == nil {
+			return "", fmt.Errorf("zdb.Paginate: column %q not in %s", c, t)
+		}
+	}
+
+	if strings.HasPrefix(query, "load:") {
+		var err error
+		query, err = Load(ctx, query[5:])
+		if err != nil {
+			return "", fmt.Errorf("zdb.Paginate: %w", err)
+		}
+	}
+
+	var (
+		cols = make([]string, 0, len(page.OrderBy))
+		dir  = ""
+		cmp  = ">"
+	)
+	if page.Desc {
+		dir, cmp = " desc", "<"
+	}
+	for _, c := range page.OrderBy {
+		cols = append(cols, quoteIdent(db.Driver(), c))
+	}
+
+	// Keep the query name as the first thing in the query.
+	var name string
+	if n := loadName(query); n != "" {
+		name = "/* " + n + " */\n"
+		query = query[len(name)-1:]
+	}
+
+	// Comments on the last line would comment out the closing paren.
+	query = name + "select * from (" + strings.TrimRight(query, "; \t\n") + "\n) as zdb_page"
+	if page.After != "" {
+		after, err := decodeCursor(page.After)
+		if err != nil {
+			return "", fmt.Errorf("zdb.Paginate: %w", err)
+		}
+		if len(after) != len(cols) {
+			return "", fmt.Errorf("zdb.Paginate: cursor has %d values, but OrderBy has %d columns", len(after), len(cols))
+		}
+
+		// Add as named parameters if the query uses them, or as positional
+		// parameters at the end otherwise.
+		_, named, _, _, err := prepareParams(params)
+		if err != nil {
+			return "", fmt.Errorf("zdb.Paginate: %w", err)
+		}
+		ph := make([]string, 0, len(after))
+		if named {
+			p := make(P, len(after))
+			for i, a := range after {
+				n := "zdb_after_" + strconv.Itoa(i)
+				p[n] = a
+				ph = append(ph, ":"+n)
+			}
+			params = append(params, p)
+		} else {
+			for _, a := range after {
+				ph = append(ph, "?")
+				params = append(params, a)
+			}
+		}
+		query += " where (" + strings.Join(cols, ", ") + ") " + cmp + " (" + strings.Join(ph, ", ") + ")"
+	}
+	query += " order by " + strings.Join(cols, dir+", ") + dir + " limit " + strconv.Itoa(page.Size+1)
+
+	err := Select(ctx, dest, query, params...)
+	if err != nil {
+		return "", fmt.Errorf("zdb.Paginate: %w", err)
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() <= page.Size {
+		return "", nil
+	}
+	rows.Set(rows.Slice(0, page.Size))
+
+	last := reflect.Indirect(rows.Index(page.Size - 1))
+	vals := make([]interface{}, 0, len(page.OrderBy))
+	for _, c := range page.OrderBy {
+		v, err := columnValue(last, c)
+		if err != nil {
+			return "", fmt.Errorf("zdb.Paginate: %w", err)
+		}
+		vals = append(vals, v)
+	}
+	next, err := encodeCursor(vals)
+	if err != nil {
+		return "", fmt.Errorf("zdb.Paginate: %w", err)
+	}
+	return next, nil
+}
+
+// Get the value for the column from a struct.
+func columnValue(row reflect.Value, col string) (interface{}, error) {
+	if row.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can't get column %q from %s", col, row.Type())
+	}
+	v := reflectx.NewMapperFunc("db", sqlx.NameMapper).FieldByName(row, col)
+	if v.Type() == row.Type() { // FieldByName() returns original struct if it's not found.
+		return nil, fmt.Errorf("column %q not in %s", col, row.Type())
+	}
+	return v.Interface(), nil
+}
+
+// The cursor is a JSON array of [type, value] pairs, so we can get the
+// original type back; encoding e.g. a time.Time as a plain string would
+// compare differently in SQLite.
+func encodeCursor(vals []interface{}) (string, error) {
+	enc := make([][2]string, 0, len(vals))
+	for _, val := range vals {
+		if v, ok := val.(driver.Valuer); ok {
+			var err error
+			val, err = v.Value()
+			if err != nil {
+				return "", err
+			}
+		}
+
+		v := reflect.ValueOf(val)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if t, ok := v.Interface().(time.Time); ok {
+			enc = append(enc, [2]string{"t", t.Format(time.RFC3339Nano)})
+			continue
+		}
+		if b, ok := v.Interface().([]byte); ok {
+			enc = append(enc, [2]string{"b", base64.StdEncoding.EncodeToString(b)})
+			continue
+		}
+		switch v.Kind() {
+		case reflect.Invalid, reflect.Ptr:
+			return "", errors.New("NULL value in OrderBy column")
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			enc = append(enc, [2]string{"i", strconv.FormatInt(v.Int(), 10)})
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			enc = append(enc, [2]string{"u", strconv.FormatUint(v.Uint(), 10)})
+		case reflect.Float32, reflect.Float64:
+			enc = append(enc, [2]string{"f", strconv.FormatFloat(v.Float(), 'g', -1, 64)})
+		case reflect.String:
+			enc = append(enc, [2]string{"s", v.String()})
+		case reflect.Bool:
+			enc = append(enc, [2]string{"B", strconv.FormatBool(v.Bool())})
+		default:
+			return "", fmt.Errorf("unsupported type in OrderBy column: %s", v.Type())
+		}
+	}
+
+	j, err := json.Marshal(enc)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(j), nil
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	j, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	var enc [][2]string
+	err = json.Unmarshal(j, &enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	vals := make([]interface{}, 0, len(enc))
+	for _, e := range enc {
+		var (
+			v   interface{}
+			err error
+		)
+		switch e[0] {
+		case "t":
+			v, err = time.Parse(time.RFC3339Nano, e[1])
+		case "b":
+			v, err = base64.StdEncoding.DecodeString(e[1])
+		case "i":
+			v, err = strconv.ParseInt(e[1], 10, 64)
+		case "u":
+			v, err = strconv.ParseUint(e[1], 10, 64)
+		case "f":
+			v, err = strconv.ParseFloat(e[1], 64)
+		case "s":
+			v = e[1]
+		case "B":
+			v, err = strconv.ParseBool(e[1])
+		default:
+			err = fmt.Errorf("unknown type %q", e[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
@@ -0,0 +1,195 @@
+package zdb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"zgo.at/zstd/ztest"
+)
+
+func TestPaginate(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table t (id int, site int, created_at timestamp)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		t1 = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		t2 = t1.Add(time.Hour)
+	)
+	for i, c := range []time.Time{t2, t1, t2, t1, t2, t1, t2} {
+		err := Exec(ctx, `insert into t values (?, 1, ?)`, i+1, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = Exec(ctx, `insert into t values (8, 2, ?)`, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		ID        int       `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	all := func(page Page) [][]int {
+		var (
+			pages [][]int
+			n     int
+		)
+		for {
+			var rows []row
+			next, err := Paginate(ctx, &rows,
+				`select id, created_at from t where site = :site -- comment`, page, P{"site": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]int, 0, len(rows))
+			for _, r := range rows {
+				ids = append(ids, r.ID)
+			}
+			pages = append(pages, ids)
+			if next == "" {
+				return pages
+			}
+			page.After = next
+
+			if n++; n > 10 {
+				t.Fatal("loop")
+			}
+		}
+	}
+
+	t.Run("asc", func(t *testing.T) {
+		have := all(Page{Size: 3, OrderBy: []string{"created_at", "id"}})
+		want := [][]int{{2, 4, 6}, {1, 3, 5}, {7}}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+	})
+	t.Run("desc", func(t *testing.T) {
+		have := all(Page{Size: 2, OrderBy: []string{"created_at", "id"}, Desc: true})
+		want := [][]int{{7, 5}, {3, 1}, {6, 4}, {2}}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+	})
+	t.Run("exact", func(t *testing.T) {
+		have := all(Page{Size: 7, OrderBy: []string{"id"}})
+		want := [][]int{{1, 2, 3, 4, 5, 6, 7}}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		var rows []*struct{ ID int }
+		next, err := Paginate(ctx, &rows, `select id from t`, Page{Size: 5, OrderBy: []string{"id"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 5 || next == "" {
+			t.Fatalf("%d %q", len(rows), next)
+		}
+		rows = nil
+		_, err = Paginate(ctx, &rows, `select id from t`, Page{Size: 5, OrderBy: []string{"id"}, After: next})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || rows[0].ID != 6 || rows[2].ID != 8 {
+			t.Errorf("%v", rows)
+		}
+	})
+
+	t.Run("positional", func(t *testing.T) {
+		h := new(testHooks)
+		ctx := WithDB(context.Background(), WithHooks(MustGetDB(ctx), h))
+
+		var rows []row
+		next, err := Paginate(ctx, &rows, "/* page */\nselect id, created_at from t where site = ?",
+			Page{Size: 6, OrderBy: []string{"id"}}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = nil
+		_, err = Paginate(ctx, &rows, "/* page */\nselect id, created_at from t where site = ?",
+			Page{Size: 6, OrderBy: []string{"id"}, After: next}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].ID != 7 {
+			t.Errorf("%v", rows)
+		}
+
+		if len(h.log) != 4 {
+			t.Fatalf("%d queries", len(h.log)/2)
+		}
+		for _, l := range h.log {
+			if strings.HasPrefix(l, "before query") && !strings.HasPrefix(l, `before query "/* page */\nselect * from (`) {
+				t.Errorf("query name not first: %s", l)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			page    Page
+			wantErr string
+		}{
+			{Page{OrderBy: []string{"id"}}, "Size must be"},
+			{Page{Size: 1}, "OrderBy is empty"},
+			{Page{Size: 1, OrderBy: []string{"id; drop table t"}}, "invalid column"},
+			{Page{Size: 1, OrderBy: []string{"id"}, After: "!!"}, "invalid cursor"},
+			{Page{Size: 1, OrderBy: []string{"id", "created_at"}, After: mustCursor(t, 1)}, "cursor has 1 values"},
+			{Page{Size: 1, OrderBy: []string{"nonexistent"}}, "not in"},
+		}
+		for _, tt := range tests {
+			t.Run("", func(t *testing.T) {
+				var rows []row
+				_, err := Paginate(ctx, &rows, `select id, created_at from t`, tt.page)
+				if !ztest.ErrorContains(err, tt.wantErr) {
+					t.Errorf("wrong error: %v", err)
+				}
+			})
+		}
+	})
+}
+
+func mustCursor(t *testing.T, vals ...interface{}) string {
+	t.Helper()
+	c, err := encodeCursor(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCursor(t *testing.T) {
+	var (
+		s   = "x"
+		now = time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	)
+	vals := []interface{}{int8(-1), uint64(1 << 63), 1.5, "x", &s, true, now, []byte("abc")}
+	c, err := encodeCursor(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := decodeCursor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(-1), uint64(1 << 63), 1.5, "x", "x", true, now, []byte("abc")}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	var np *string
+	_, err = encodeCursor([]interface{}{np})
+	if !ztest.ErrorContains(err, "NULL value") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package zdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// QueryError is returned for errors from the database when running a query.
+//
+// This unwraps to the driver error, so errors.As() and ClassifyError() still
+// work.
+type QueryError struct {
+	Name     string // Query name from Load() or "load:"; may be empty.
+	Query    string // Query text, truncated to 500 bytes.
+	NParams  int    // Number of parameters.
+	Location string // Caller location as file:line.
+	Err      error  // Original error.
+}
+
+func (e *QueryError) Error() string {
+	q := e.Name
+	if q == "" {
+		q = strings.Join(strings.Fields(e.Query), " ")
+		if len(q) > 60 {
+			q = q[:60] + "…"
+		}
+	}
+	return fmt.Sprintf("query %q at %s: %s", q, e.Location, e.Err)
+}
+
+func (e *QueryError) Unwrap() error { return e.Err }
+
+// Wrap err in a QueryError; sql.ErrNoRows is never wrapped as it's usually
+// compared with ==.
+func queryErr(query string, params []interface{}, err error) error {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	name := loadName(query)
+	if len(query) > 500 {
+		query = query[:500] + "…"
+	}
+	return &QueryError{
+		Name:     name,
+		Query:    query,
+		NParams:  len(params),
+		Location: callerLoc(),
+		Err:      err,
+	}
+}
+
+// Get the query name from the /* name */ comment Load() adds; returns an empty
+// string if there is none.
+func loadName(query string) string {
+	if strings.HasPrefix(query, "/* ") {
+		if i := strings.Index(query, " */"); i > -1 {
+			return query[3:i]
+		}
+	}
+	return ""
+}
+
+// Get the location of the first caller outside of zdb; the number of frames
+// varies depending on wrappers and such, so we can't use a fixed depth.
+func callerLoc() string {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "zgo.at/zdb.") || strings.HasSuffix(f.File, "_test.go") {
+			return f.File[strings.LastIndexByte(f.File, '/')+1:] + fmt.Sprintf(":%d", f.Line)
+		}
+		if !more {
+			return "???:0"
+		}
+	}
+}
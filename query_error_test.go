@@ -0,0 +1,83 @@
+package zdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"zgo.at/zdb/testdata"
+)
+
+func TestQueryError(t *testing.T) {
+	ctx := StartTest(t)
+
+	t.Run("plain", func(t *testing.T) {
+		err := Exec(ctx, `select * from nonexistent`, P{"x": 1})
+
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			t.Fatalf("not a QueryError: %#v", err)
+		}
+		if qErr.Name != "" || qErr.Query != "select * from nonexistent" || qErr.NParams != 0 {
+			t.Errorf("%#v", qErr)
+		}
+		if !strings.HasPrefix(qErr.Location, "query_error_test.go:") {
+			t.Errorf("wrong location: %q", qErr.Location)
+		}
+		if e := ClassifyError(err); e == nil {
+			t.Error("ClassifyError: nil")
+		}
+		if !strings.HasPrefix(err.Error(), `query "select * from nonexistent" at query_error_test.go:`) {
+			t.Errorf("wrong error: %s", err)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		db, err := Connect(ConnectOptions{
+			Connect: "sqlite3://:memory:",
+			Files:   testdata.Files,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		ctx := WithDB(context.Background(), db)
+
+		// No tables, so this fails.
+		var v []int
+		err = Select(ctx, &v, "load:hit_list.GetTotalCount", P{"site": 1, "start": 1, "end": 1, "tz": 1, "filter": []int{1}})
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			t.Fatalf("not a QueryError: %#v", err)
+		}
+		if qErr.Name != "hit_list.GetTotalCount" || qErr.NParams == 0 {
+			t.Errorf("%#v", qErr)
+		}
+		if !strings.HasPrefix(err.Error(), `query "hit_list.GetTotalCount" at query_error_test.go:`) {
+			t.Errorf("wrong error: %s", err)
+		}
+	})
+
+	t.Run("tx", func(t *testing.T) {
+		err := TX(ctx, func(ctx context.Context) error {
+			return Exec(ctx, `select * from nonexistent`)
+		})
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			t.Fatalf("not a QueryError: %#v", err)
+		}
+		if !strings.HasPrefix(qErr.Location, "query_error_test.go:") {
+			t.Errorf("wrong location: %q", qErr.Location)
+		}
+	})
+
+	t.Run("no rows", func(t *testing.T) {
+		var i int
+		err := Get(ctx, &i, `select 1 where 1=0`)
+		if err != sql.ErrNoRows {
+			t.Errorf("wrong error: %#v", err)
+		}
+	})
+}
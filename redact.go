@@ -0,0 +1,168 @@
+package zdb
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Secret is a string parameter which is shown as '[redacted]' in Dump(),
+// ApplyParams(), and the LogDB output, instead of the actual value.
+//
+//   zdb.Exec(ctx, `update users set password = ? where id = ?`, zdb.Secret(pwd), id)
+//
+// It's sent to the database as a regular string.
+type Secret string
+
+func (s Secret) String() string   { return "[redacted]" }
+func (s Secret) GoString() string { return `zdb.Secret("[redacted]")` }
+
+// Redact is a list of patterns for parameter and column names to show as
+// [redacted] in Dump() and the LogDB output.
+//
+// This applies to named parameters (":password"), struct fields with
+// db:",secret", and columns in the query result; it can't be applied to
+// positional parameters, as there is no name to match: use Secret for those.
+//
+// Patterns are matched case-insensitive with path.Match(). Add it as a
+// parameter to Dump(), or pass the patterns to NewLogDB(), NewSlowLogDB(), or
+// NewStructuredLogDB():
+//
+//   zdb.Dump(ctx, os.Stdout, `select * from users`, zdb.Redact{"*password*", "*_token"})
+//
+// Parameters are only redacted in the output; the actual values are always
+// sent to the database.
+type Redact []string
+
+// Report if the parameter or column name matches any of the patterns.
+func (r Redact) match(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range r {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace values in columns that match the patterns.
+func (r Redact) rows(cols []string, rows [][]interface{}) {
+	if len(r) == 0 {
+		return
+	}
+	for i, c := range cols {
+		if !r.match(c) {
+			continue
+		}
+		for _, row := range rows {
+			if i < len(row) && row[i] != nil {
+				row[i] = "[redacted]"
+			}
+		}
+	}
+}
+
+// Get a copy of the parameters with redacted parameters replaced by a Secret,
+// for display. The names are from the context; see withParamNames().
+func (r Redact) params(ctx context.Context, params []interface{}) []interface{} {
+	pn, _ := ctx.Value(paramkey).(*paramNames)
+	if pn == nil || len(pn.names) != len(params) {
+		return params
+	}
+
+	var cp []interface{}
+	for i, n := range pn.names {
+		if params[i] == nil || !(pn.secret[n] || r.match(n)) {
+			continue
+		}
+		if cp == nil {
+			cp = append(make([]interface{}, 0, len(params)), params...)
+		}
+		cp[i] = Secret("")
+	}
+	if cp == nil {
+		return params
+	}
+	return cp
+}
+
+// paramNames are the names of the parameters after Prepare(); this is used to
+// redact parameters by name in the output, without changing the parameters
+// that are sent to the database.
+type paramNames struct {
+	names  []string        // Name for every parameter.
+	secret map[string]bool // Struct fields with db:",secret".
+}
+
+var paramkey = &struct{ n string }{"zdb.paramNames"}
+
+// withParamNames returns a copy of the context with the parameter names; this
+// is set on the context passed to the DB wrappers.
+//
+// A nil pn clears names from an earlier query on the same context.
+func withParamNames(ctx context.Context, pn *paramNames) context.Context {
+	if pn == nil {
+		if _, ok := ctx.Value(paramkey).(*paramNames); !ok {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, paramkey, pn)
+}
+
+type secretField struct {
+	fi   *reflectx.FieldInfo
+	name string
+}
+
+// Get struct fields with db:",secret" or db:"name,secret".
+//
+// sqlx uses an empty name for the first form, so get the name from the field
+// name.
+func secretFields(t reflect.Type, mapper *reflectx.Mapper) []secretField {
+	var f []secretField
+	for _, fi := range mapper.TypeMap(t).Index {
+		if _, ok := fi.Options["secret"]; !ok {
+			continue
+		}
+		name := fi.Name
+		if name == "" {
+			name = sqlx.NameMapper(fi.Field.Name)
+			if fi.Parent != nil && fi.Parent.Path != "" {
+				name = fi.Parent.Path + "." + name
+			}
+		}
+		f = append(f, secretField{fi: fi, name: name})
+	}
+	return f
+}
+
+// Get the names of all secret struct fields in the parameters.
+func secretNames(params []interface{}) map[string]bool {
+	var (
+		names  map[string]bool
+		mapper *reflectx.Mapper
+	)
+	for _, p := range params {
+		if p == nil {
+			continue
+		}
+		t := typeOfElem(p)
+		if t.Kind() != reflect.Struct || !isNamed(t, p) {
+			continue
+		}
+		if mapper == nil {
+			mapper = reflectx.NewMapperFunc("db", sqlx.NameMapper)
+		}
+		for _, f := range secretFields(t, mapper) {
+			if names == nil {
+				names = make(map[string]bool)
+			}
+			names[f.name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,123 @@
+package zdb
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	ctx := StartTest(t)
+
+	err := Exec(ctx, `create table users (id int, email varchar(255), password varchar(255))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("secret", func(t *testing.T) {
+		err := Exec(ctx, `insert into users values (?, ?, ?)`, 1, "a@example.com", Secret("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pwd string
+		err = Get(ctx, &pwd, `select password from users where id = 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pwd != "hunter2" {
+			t.Errorf("wrong value stored: %q", pwd)
+		}
+
+		have := ApplyParams(`insert into users values (?, ?, ?)`, 1, "a@example.com", Secret("hunter2"))
+		want := `insert into users values (1, 'a@example.com', '[redacted]');`
+		if have != want {
+			t.Errorf("\nhave: %s\nwant: %s", have, want)
+		}
+		if s := fmt.Sprintf("%v %s %#v", Secret("x"), Secret("x"), Secret("x")); strings.Contains(s, "x\"") || strings.Contains(s, " x") {
+			t.Errorf("not redacted: %s", s)
+		}
+	})
+
+	t.Run("struct tag", func(t *testing.T) {
+		type user struct {
+			ID       int    `db:"id"`
+			Email    string `db:"email"`
+			Password string `db:",secret"`
+		}
+		u := user{ID: 2, Email: "b@example.com", Password: "hunter3"}
+
+		// Prepare() returns the actual values.
+		_, params, err := Prepare(ctx, `insert into users values (:id, :email, :password)`, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(params) != "[2 b@example.com hunter3]" {
+			t.Errorf("wrong params: %v", params)
+		}
+
+		buf := new(bytes.Buffer)
+		ctx := wrapDB(ctx, func(db DB) DB { return NewLogDB(db, buf, DumpQuery, "") })
+		err = Exec(ctx, `insert into users values (:id, :email, :password)`, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := buf.String(); !strings.Contains(out, "'b@example.com', '[redacted]'") || strings.Contains(out, "hunter3") {
+			t.Errorf("not redacted:\n%s", out)
+		}
+
+		have := DumpString(ctx, `select :email, :password`, u, DumpQuery)
+		if !strings.Contains(have, "'[redacted]'") || strings.Contains(have, "hunter3") {
+			t.Errorf("not redacted:\n%s", have)
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		ctx := wrapDB(ctx, func(db DB) DB { return NewLogDB(db, buf, DumpQuery|DumpResult, "", "*password*") })
+
+		err := Exec(ctx, `update users set password = :password where id = :id`, P{"password": "new", "id": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := buf.String(); !strings.Contains(out, "password = '[redacted]'") || strings.Contains(out, "new") {
+			t.Errorf("not redacted:\n%s", out)
+		}
+
+		buf.Reset()
+		var emails []struct {
+			Email    string `db:"email"`
+			Password string `db:"password"`
+		}
+		err = Select(ctx, &emails, `select email, password from users where id = :id`, P{"id": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := buf.String(); !strings.Contains(out, "a@example.com  [redacted]") || strings.Contains(out, "new") {
+			t.Errorf("not redacted:\n%s", out)
+		}
+		if emails[0].Password != "new" {
+			t.Errorf("wrong value: %q", emails[0].Password)
+		}
+
+		have := DumpString(ctx, `select id, email, password from users order by id`, Redact{"PASSWORD"})
+		want := "id  email          password\n" +
+			"1   a@example.com  [redacted]\n" +
+			"2   b@example.com  [redacted]\n"
+		if have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+
+		have = DumpString(ctx, `select id from users where password = :password`, P{"password": "new"}, Redact{"password"}, DumpQuery)
+		if !strings.Contains(have, "password = '[redacted]'") {
+			t.Errorf("not redacted:\n%s", have)
+		}
+
+		// Nothing is redacted by name by default.
+		have = DumpString(ctx, `select password as token_count from users order by id`)
+		want = "token_count\nnew\nhunter3\n"
+		if have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type slowLogDB struct {
+	DB
+	threshold time.Duration
+	out       io.Writer
+	logWhat   DumpArg
+	redact    Redact
+	mu        *sync.Mutex
+}
+
+// NewSlowLogDB returns a DB wrapper to log queries that take longer than
+// threshold, with the parameters and location of the caller.
+//
+// Only the query is logged if logWhat is 0; add DumpExplain to also log the
+// query plan. This uses plain EXPLAIN without ANALYZE, so the query is never run
+// again.
+//
+// For Query() only the time until the first row is available is measured, not
+// the time it takes to read all rows.
+//
+// Parameters with a name matching any of the redact patterns are shown as
+// [redacted]; see Redact.
+func NewSlowLogDB(db DB, threshold time.Duration, out io.Writer, logWhat DumpArg, redact ...string) DB {
+	return &slowLogDB{
+		DB:        db,
+		threshold: threshold,
+		out:       out,
+		logWhat:   (logWhat & DumpExplain) | DumpQuery,
+		redact:    redact,
+		mu:        new(sync.Mutex),
+	}
+}
+
+func (d slowLogDB) Unwrap() DB { return d.DB }
+
+func (d slowLogDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
+	ctx, tx, err := d.DB.Begin(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	sdb := &slowLogDB{DB: tx, threshold: d.threshold, out: d.out, logWhat: d.logWhat, redact: d.redact, mu: d.mu}
+	return WithDB(ctx, sdb), sdb, nil
+}
+
+func (d slowLogDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	defer d.log(ctx, query, params)()
+	return d.DB.(dbImpl).ExecContext(ctx, query, params...)
+}
+func (d slowLogDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	defer d.log(ctx, query, params)()
+	return d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
+}
+func (d slowLogDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	defer d.log(ctx, query, params)()
+	return d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
+}
+func (d slowLogDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	defer d.log(ctx, query, params)()
+	return d.DB.(dbImpl).QueryxContext(ctx, query, params...)
+}
+
+func (d slowLogDB) log(ctx context.Context, query string, params []interface{}) func() {
+	start := time.Now()
+	return func() {
+		took := time.Since(start)
+		if took < d.threshold {
+			return
+		}
+		db, ok := GetDB(ctx)
+		if !ok {
+			return
+		}
+
+		// Write everything at once, so that concurrent queries don't get mixed
+		// up.
+		buf := new(bytes.Buffer)
+		fmt.Fprintf(buf, "zdb.SlowLogDB: %s at %s\n", took.Round(time.Microsecond), callerLoc())
+		// Use plain EXPLAIN, as the query was already slow.
+		args := append(append(make([]interface{}, 0, len(params)+4), params...),
+			d.logWhat, d.redact, dumpFromLog{write: isWrite(query), plan: true})
+		Dump(WithDB(ctx, Unwrap(db)), buf, query, args...)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.out.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,73 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLogDB(t *testing.T) {
+	ctx := startWrapTest(t, 3)
+
+	t.Run("fast", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		ctx := wrapDB(ctx, func(db DB) DB { return NewSlowLogDB(db, time.Hour, buf, 0) })
+
+		var i int
+		err := Get(ctx, &i, `select i from x where i = ?`, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("logged:\n%s", buf.String())
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		ctx := wrapDB(ctx, func(db DB) DB { return NewSlowLogDB(db, time.Nanosecond, buf, 0) })
+
+		var i, j int
+		err := Get(ctx, &i, `select i from x where i = ?`, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = TX(ctx, func(ctx context.Context) error {
+			return Get(ctx, &j, `select i from x where i = :i`, P{"i": 3})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		have := regexp.MustCompile(`SlowLogDB: \S+ at slowlog_test.go:\d+`).ReplaceAllString(buf.String(), "SlowLogDB: X at slowlog_test.go:XX")
+		want := "zdb.SlowLogDB: X at slowlog_test.go:XX\nselect i from x where i = 2;\n\n" +
+			"zdb.SlowLogDB: X at slowlog_test.go:XX\nselect i from x where i = 3;\n\n"
+		if have != want {
+			t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+		}
+	})
+
+	t.Run("explain", func(t *testing.T) {
+		if Driver(ctx) == DriverMariaDB {
+			t.Skip("EXPLAIN not supported for MariaDB")
+		}
+		buf := new(bytes.Buffer)
+		ctx := wrapDB(ctx, func(db DB) DB { return NewSlowLogDB(db, 0, buf, DumpExplain) })
+
+		var i int
+		err := Get(ctx, &i, `select i from x where i = ?`, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "QUERY") || !strings.Contains(buf.String(), "EXPLAIN") {
+			t.Errorf("no explain:\n%s", buf.String())
+		}
+		// Plain EXPLAIN doesn't run the query again.
+		if strings.Contains(buf.String(), "actual time=") {
+			t.Errorf("used EXPLAIN ANALYZE:\n%s", buf.String())
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package zdb
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StmtCacheStats are statistics for the prepared statement cache; see
+// StmtCache in ConnectOptions.
+type StmtCacheStats struct {
+	Size      int    // Number of statements currently in the cache.
+	Max       int    // Maximum number of statements.
+	Hits      uint64 // Number of times a cached statement was used.
+	Misses    uint64 // Number of times a statement had to be prepared.
+	Evictions uint64 // Number of statements removed from the cache.
+}
+
+// HitRate gets the ratio of hits to the total number of lookups, as a number
+// from 0 to 1.
+func (s StmtCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// StmtStats gets statistics for the prepared statement cache.
+//
+// This will return the zero value if the cache isn't enabled.
+func StmtStats(db DB) StmtCacheStats {
+	c := Unwrap(db).(interface{ stmtCache() *stmtCache }).stmtCache()
+	if c == nil {
+		return StmtCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size, s.Max = c.lru.Len(), c.max
+	return s
+}
+
+// stmtCache is a LRU cache of prepared statements, keyed by the final query
+// text (after Prepare()).
+//
+// Statements are reference-counted, so that a statement evicted while it's
+// being used by another goroutine is closed only once that's finished.
+type stmtCache struct {
+	mu     sync.Mutex
+	max    int
+	lru    *list.List
+	items  map[string]*list.Element
+	stats  StmtCacheStats
+	parent *stmtCache // Record statistics here instead; set for transactions.
+}
+
+type preparer interface {
+	PreparexContext(context.Context, string) (*sqlx.Stmt, error)
+}
+
+type stmtEntry struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(max int) *stmtCache {
+	if max <= 0 {
+		return nil
+	}
+	return &stmtCache{max: max, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+// newTxStmtCache makes a cache for the statements prepared in a transaction,
+// with the same size as the parent. These are closed by database/sql when the
+// transaction ends.
+//
+// The statements are prepared on the transaction's connection directly, rather
+// than rebinding the statement from the parent's cache, as that would prepare
+// it twice.
+func newTxStmtCache(parent *stmtCache) *stmtCache {
+	if parent == nil {
+		return nil
+	}
+	c := newStmtCache(parent.max)
+	c.parent = parent
+	return c
+}
+
+// Update the statistics; c.mu must be held.
+func (c *stmtCache) stat(f func(*StmtCacheStats)) {
+	if c.parent == nil {
+		f(&c.stats)
+		return
+	}
+	c.parent.mu.Lock()
+	defer c.parent.mu.Unlock()
+	f(&c.parent.stats)
+}
+
+// get a statement from the cache, preparing it if it's not in the cache yet.
+//
+// The entry must be released with release() after use.
+func (c *stmtCache) get(ctx context.Context, db preparer, query string) (*stmtEntry, error) {
+	c.mu.Lock()
+	if e, ok := c.items[query]; ok {
+		c.stat(func(s *StmtCacheStats) { s.Hits++ })
+		c.lru.MoveToFront(e)
+		entry := e.Value.(*stmtEntry)
+		entry.refs++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.stat(func(s *StmtCacheStats) { s.Misses++ })
+	c.mu.Unlock()
+
+	// Don't hold the lock while preparing, as this needs a roundtrip to the
+	// server.
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Someone else prepared the same query in the meanwhile.
+	if e, ok := c.items[query]; ok {
+		stmt.Close()
+		entry := e.Value.(*stmtEntry)
+		entry.refs++
+		return entry, nil
+	}
+
+	entry := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	c.items[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		old := e.Value.(*stmtEntry)
+		delete(c.items, old.query)
+		c.stat(func(s *StmtCacheStats) { s.Evictions++ })
+		old.evicted = true
+		if old.refs == 0 {
+			old.stmt.Close()
+		}
+	}
+	return entry, nil
+}
+
+func (c *stmtCache) release(entry *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+func (c *stmtCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.items {
+		e.Value.(*stmtEntry).stmt.Close()
+	}
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Report if the query can be cached: only single-statement select, insert,
+// update, and delete queries are. Everything else (DDL, multiple statements in
+// a schema or migration, etc.) is run as-is.
+func cacheable(query string) bool {
+	q, ok := trimComments(query)
+	if !ok {
+		return false
+	}
+	switch firstWord(q) {
+	case "select", "insert", "update", "delete":
+	default:
+		return false
+	}
+	// This may reject some queries with a ; in a string, which is fine.
+	return !strings.Contains(strings.TrimRight(q, "; \t\n"), ";")
+}
@@ -0,0 +1,163 @@
+package zdb
+
+import (
+	"context"
+	"testing"
+
+	"zgo.at/zdb/testdata"
+)
+
+func TestStmtCache(t *testing.T) {
+	ctx := StartTest(t, ConnectOptions{StmtCache: 2})
+
+	err := Exec(ctx, `create table t (i int)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := StmtStats(MustGetDB(ctx))
+	for i := 0; i < 3; i++ {
+		err := Exec(ctx, `insert into t values (:i)`, P{"i": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := StmtStats(MustGetDB(ctx)); s.Hits-start.Hits != 2 || s.Misses-start.Misses != 1 || s.Size != 1 || s.Max != 2 {
+		t.Errorf("%+v", s)
+	}
+
+	var n int
+	err = Get(ctx, &n, `select count(*) from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("n = %d", n)
+	}
+	var is []int
+	err = Select(ctx, &is, `select i from t order by i`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(is) != 3 {
+		t.Errorf("is = %v", is)
+	}
+	if s := StmtStats(MustGetDB(ctx)); s.Evictions-start.Evictions != 1 || s.Size != 2 {
+		t.Errorf("%+v", s)
+	}
+
+	t.Run("tx", func(t *testing.T) {
+		err := TX(ctx, func(ctx context.Context) error {
+			for i := 0; i < 2; i++ {
+				var n int
+				err := Get(ctx, &n, `select count(*) from t`)
+				if err != nil {
+					return err
+				}
+				if n != 3 {
+					t.Errorf("n = %d", n)
+				}
+			}
+			return Exec(ctx, `insert into t values (:i)`, P{"i": 4})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Get(ctx, &n, `select count(*) from t`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 4 {
+			t.Errorf("n = %d", n)
+		}
+	})
+
+	t.Run("tx limit", func(t *testing.T) {
+		start := StmtStats(MustGetDB(ctx))
+		err := TX(ctx, func(ctx context.Context) error {
+			for _, q := range []string{`select 1`, `select 2`, `select 3`, `select 1`} {
+				var n int
+				err := Get(ctx, &n, q)
+				if err != nil {
+					return err
+				}
+			}
+			if s := StmtStats(MustGetDB(ctx)); s.Misses-start.Misses != 4 || s.Evictions-start.Evictions != 2 {
+				t.Errorf("%+v", s)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("multiple statements", func(t *testing.T) {
+		start := StmtStats(MustGetDB(ctx))
+		err := Exec(ctx, `create table a (i int); create table b (i int);`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Exec(ctx, `insert into b values (1)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := StmtStats(MustGetDB(ctx)); s.Misses-start.Misses != 1 {
+			t.Errorf("%+v", s)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		ctx := StartTest(t, ConnectOptions{StmtCache: 2, Files: testdata.Files})
+		var n int
+		err := Get(ctx, &n, `select count(*) from factions`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := StmtStats(MustGetDB(ctx)); s.Misses != 1 || s.Size != 1 {
+			t.Errorf("%+v", s)
+		}
+	})
+
+	t.Run("hitrate", func(t *testing.T) {
+		if r := (StmtCacheStats{Hits: 3, Misses: 1}).HitRate(); r != 0.75 {
+			t.Errorf("%f", r)
+		}
+		if r := (StmtCacheStats{}).HitRate(); r != 0 {
+			t.Errorf("%f", r)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx := StartTest(t)
+		if s := StmtStats(MustGetDB(ctx)); s != (StmtCacheStats{}) {
+			t.Errorf("%+v", s)
+		}
+	})
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`select 1`, true},
+		{`/* name */ select 1;`, true},
+		{"-- comment\nupdate x set i = 1;\n", true},
+		{`insert into x values (1)`, true},
+		{`delete from x`, true},
+		{`create table x (i int)`, false},
+		{`select 1; select 2`, false},
+		{`insert into x values (1); insert into x values (2);`, false},
+		{`pragma table_info(x)`, false},
+		{`/* unterminated select 1`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if have := cacheable(tt.query); have != tt.want {
+				t.Errorf("have %t; want %t", have, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Logger is a structured logger with key/value pairs.
+//
+// This is compatible with log/slog, so a *slog.Logger can be used directly.
+type Logger interface {
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+}
+
+type structLogDB struct {
+	DB
+	logger Logger
+	filter string
+	redact Redact
+	txid   uint64
+}
+
+// Counter for transaction IDs in the structured log.
+var lastTxID uint64
+
+// NewStructuredLogDB returns a DB wrapper to log queries to a structured
+// logger.
+//
+// Every query is logged as "query" with the keys:
+//
+//   name        Query name from Load(); omitted if there is none.
+//   query       Normalized query, with literals replaced by "?".
+//   params      Parameters, as a list of strings.
+//   duration    Time it took to run the query.
+//   rows        Rows returned or affected; omitted for Query().
+//   error       Error message; omitted if there is no error.
+//   caller      Location of the caller as file:line.
+//   tx          Transaction ID; omitted if this isn't a transaction.
+//
+// Queries that return an error are logged with ErrorContext(), and everything
+// else with InfoContext().
+//
+// The filter and redact patterns work like NewLogDB().
+func NewStructuredLogDB(db DB, logger Logger, filter string, redact ...string) DB {
+	return &structLogDB{DB: db, logger: logger, filter: filter, redact: redact}
+}
+
+func (d structLogDB) Unwrap() DB { return d.DB }
+
+func (d structLogDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
+	ctx, tx, err := d.DB.Begin(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	ldb := &structLogDB{DB: tx, logger: d.logger, filter: d.filter, redact: d.redact, txid: atomic.AddUint64(&lastTxID, 1)}
+	return WithDB(ctx, ldb), ldb, nil
+}
+
+func (d structLogDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).ExecContext(ctx, query, params...)
+	rows := int64(-1)
+	if err == nil {
+		rows, _ = r.RowsAffected()
+	}
+	d.log(ctx, query, params, start, rows, err)
+	return r, err
+}
+func (d structLogDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).GetContext(ctx, dest, query, params...)
+	rows := int64(1)
+	if err != nil {
+		rows = 0
+	}
+	d.log(ctx, query, params, start, rows, err)
+	return err
+}
+func (d structLogDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	start := time.Now()
+	err := d.DB.(dbImpl).SelectContext(ctx, dest, query, params...)
+	rows := int64(-1)
+	if v := reflect.Indirect(reflect.ValueOf(dest)); err == nil && v.Kind() == reflect.Slice {
+		rows = int64(v.Len())
+	}
+	d.log(ctx, query, params, start, rows, err)
+	return err
+}
+func (d structLogDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	r, err := d.DB.(dbImpl).QueryxContext(ctx, query, params...)
+	d.log(ctx, query, params, start, -1, err)
+	return r, err
+}
+
+func (d structLogDB) log(ctx context.Context, query string, params []interface{}, start time.Time, rows int64, err error) {
+	took := time.Since(start)
+	if d.filter != "" && !strings.Contains(reNormSpace.ReplaceAllString(query, " "), d.filter) {
+		return
+	}
+
+	name := loadName(query)
+	if name != "" {
+		query = query[strings.Index(query, " */")+3:]
+	}
+	p := make([]string, 0, len(params))
+	for _, pp := range d.redact.params(ctx, params) {
+		p = append(p, formatParam(pp, false))
+	}
+
+	args := make([]interface{}, 0, 16)
+	if name != "" {
+		args = append(args, "name", name)
+	}
+	args = append(args, "query", normalizeQuery(query), "params", p, "duration", took)
+	if rows > -1 {
+		args = append(args, "rows", rows)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		args = append(args, "error", err.Error())
+	}
+	args = append(args, "caller", callerLoc())
+	if d.txid > 0 {
+		args = append(args, "tx", d.txid)
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		d.logger.ErrorContext(ctx, "query", args...)
+	} else {
+		d.logger.InfoContext(ctx, "query", args...)
+	}
+}
+
+type jsonLogger struct {
+	out io.Writer
+	mu  *sync.Mutex
+}
+
+// NewJSONLogger returns a Logger which writes one JSON object per line to out,
+// in the same format as slog.JSONHandler.
+//
+//   {"time":"2021-06-01T12:00:00.123Z","level":"INFO","msg":"query","query":"select ?","params":["1"],"duration":93000,...}
+func NewJSONLogger(out io.Writer) Logger {
+	return &jsonLogger{out: out, mu: new(sync.Mutex)}
+}
+
+func (l jsonLogger) InfoContext(ctx context.Context, msg string, args ...interface{}) {
+	l.log("INFO", msg, args)
+}
+func (l jsonLogger) ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	l.log("ERROR", msg, args)
+}
+
+func (l jsonLogger) log(level, msg string, args []interface{}) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`{"time":`)
+	l.write(buf, time.Now())
+	buf.WriteString(`,"level":`)
+	l.write(buf, level)
+	buf.WriteString(`,"msg":`)
+	l.write(buf, msg)
+	for i := 0; i < len(args); i += 2 {
+		buf.WriteByte(',')
+		l.write(buf, fmt.Sprintf("%v", args[i]))
+		buf.WriteByte(':')
+		if i+1 < len(args) {
+			l.write(buf, args[i+1])
+		} else {
+			buf.WriteString("null")
+		}
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+func (l jsonLogger) write(buf *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprintf("!ERROR: %s", err))
+	}
+	buf.Write(j)
+}
@@ -0,0 +1,66 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStructuredLogDB(t *testing.T) {
+	ctx := startWrapTest(t, 3)
+
+	buf := new(bytes.Buffer)
+	ctx = wrapDB(ctx, func(db DB) DB { return NewStructuredLogDB(db, NewJSONLogger(buf), "") })
+
+	var i []struct{ I int }
+	err := Select(ctx, &i, "/* select-x */\nselect i from x where i > :i", P{"i": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TX(ctx, func(ctx context.Context) error {
+		return Exec(ctx, `update x set i = i + 1 where i = 'a' or i = 3`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Exec(ctx, `select nonexistent from x`)
+	if err == nil {
+		t.Fatal("no error")
+	}
+
+	var have []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var l map[string]interface{}
+		err := json.Unmarshal([]byte(line), &l)
+		if err != nil {
+			t.Fatalf("%s: %q", err, line)
+		}
+		if l["time"] == "" || l["duration"] == nil {
+			t.Errorf("no time or duration: %q", line)
+		}
+		delete(l, "time")
+		delete(l, "duration")
+		have = append(have, l)
+	}
+
+	want := []map[string]interface{}{
+		{"level": "INFO", "msg": "query", "name": "select-x", "query": "select i from x where i > ?",
+			"params": []interface{}{"1"}, "rows": 2.0, "caller": "structlog_test.go:19"},
+		{"level": "INFO", "msg": "query", "query": "update x set i = i + ? where i = ? or i = ?",
+			"params": []interface{}{}, "rows": 1.0, "caller": "structlog_test.go:24", "tx": have[1]["tx"]},
+		{"level": "ERROR", "msg": "query", "query": "select nonexistent from x",
+			"params": []interface{}{}, "error": have[2]["error"], "caller": "structlog_test.go:29"},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+	if tx, _ := have[1]["tx"].(float64); tx < 1 {
+		t.Errorf("wrong tx: %v", have[1]["tx"])
+	}
+	if e, _ := have[2]["error"].(string); !strings.Contains(e, "nonexistent") {
+		t.Errorf("wrong error: %v", have[2]["error"])
+	}
+}
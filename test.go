@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/fs"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"text/tabwriter"
@@ -80,10 +81,31 @@ const (
 //   DumpCSV        Show as CSV.
 //   DumpJSON       Show as an array of JSON objects.
 //   DumpHTML       Show as a HTML table.
+//
+// Secret parameters and struct fields with db:",secret" are shown as
+// [redacted]. Add a Redact parameter to also redact named parameters and
+// columns by name.
 func Dump(ctx context.Context, out io.Writer, query string, params ...interface{}) {
 	var dump DumpArg
 	params = dump.extract(params)
 
+	var (
+		fromLog dumpFromLog
+		red     Redact
+	)
+	for i := 0; i < len(params); i++ {
+		switch p := params[i].(type) {
+		case dumpFromLog:
+			fromLog = p
+		case Redact:
+			red = p
+		default:
+			continue
+		}
+		params = append(params[:i:i], params[i+1:]...)
+		i--
+	}
+
 	var nsections int
 	if dump.has(DumpQuery) {
 		nsections++
@@ -111,7 +133,9 @@ func Dump(ctx context.Context, out io.Writer, query string, params ...interface{
 	)
 
 	if dump.has(DumpLocation) {
-		if dump.has(dumpFromLogDB) {
+		if fromLog.loc != "" {
+			fmt.Fprintf(out, "zdb.LogDB: %s\n", bold(fromLog.loc))
+		} else if dump.has(dumpFromLogDB) {
 			fmt.Fprintf(out, "zdb.LogDB: %s\n", bold(zdebug.Loc(5)))
 		} else {
 			fmt.Fprintf(out, "zdb.Dump: %s\n", bold(zdebug.Loc(4)))
@@ -119,7 +143,15 @@ func Dump(ctx context.Context, out io.Writer, query string, params ...interface{
 	}
 
 	if dump.has(DumpQuery) {
-		section("QUERY", ApplyParams(query, params...))
+		// Parameters are only named after Prepare(), which LogDB already did.
+		q, p, qctx := query, params, ctx
+		if _, ok := ctx.Value(paramkey).(*paramNames); !ok && (len(red) > 0 || secretNames(params) != nil) {
+			pq, pp, pn, err := prepareNames(ctx, MustGetDB(ctx), query, params...)
+			if err == nil {
+				q, p, qctx = pq, pp, withParamNames(ctx, pn)
+			}
+		}
+		section("QUERY", ApplyParams(q, red.params(qctx, p)...))
 	}
 
 	if dump.has(DumpExplain) {
@@ -131,9 +163,18 @@ func Dump(ctx context.Context, out io.Writer, query string, params ...interface{
 		default:
 			err = errors.New("zdb.LogDB: unsupported driver for LogExplain " + MustGetDB(ctx).DriverName())
 		case DriverPostgreSQL:
-			err = Select(ctx, &explain, `explain analyze `+query, params...)
+			// EXPLAIN ANALYZE runs the query, so don't use it for writes.
+			if fromLog.write || fromLog.plan {
+				err = Select(ctx, &explain, `explain `+query, params...)
+			} else {
+				err = Select(ctx, &explain, `explain analyze `+query, params...)
+			}
 		case DriverMariaDB:
-			// TODO
+			var plan *Plan
+			plan, err = explainPlan(ctx, query, !fromLog.plan, params)
+			if err == nil {
+				explain = strings.Split(strings.TrimRight(plan.String(), "\n"), "\n")
+			}
 		case DriverSQLite:
 			var sqe []struct {
 				ID, Parent, Notused int
@@ -157,29 +198,37 @@ func Dump(ctx context.Context, out io.Writer, query string, params ...interface{
 		}
 	}
 
-	if dump.has(DumpResult) {
+	if dump.has(DumpResult) && fromLog.result != nil {
+		section("RESULT", *fromLog.result)
+	} else if dump.has(DumpResult) {
 		buf := new(bytes.Buffer)
 		err := func() error {
 			rows, err := Query(ctx, query, params...)
 			if err != nil {
 				return err
 			}
+			defer rows.Close()
 			cols, err := rows.Columns()
 			if err != nil {
 				return err
 			}
+			all, err := scanAll(rows)
+			if err != nil {
+				return err
+			}
+			red.rows(cols, all)
 
 			switch {
 			default:
-				return dumpHorizontal(buf, rows, cols)
+				return writeHorizontal(buf, cols, all)
 			case dump.has(DumpVertical):
-				return dumpVertical(buf, rows, cols)
+				return writeVertical(buf, cols, all)
 			case dump.has(DumpCSV):
-				return dumpCSV(buf, rows, cols)
+				return writeCSV(buf, cols, all)
 			case dump.has(DumpJSON):
-				return dumpJSON(buf, rows, cols)
+				return writeJSON(buf, cols, all)
 			case dump.has(DumpHTML):
-				return dumpHTML(buf, rows, cols)
+				return writeHTML(buf, cols, all)
 			}
 		}()
 		if err != nil {
@@ -192,17 +241,24 @@ func Dump(ctx context.Context, out io.Writer, query string, params ...interface{
 	fmt.Fprintln(out)
 }
 
-func dumpHorizontal(buf io.Writer, rows *Rows, cols []string) error {
-	t := tabwriter.NewWriter(buf, 4, 4, 2, ' ', 0)
-	t.Write([]byte(strings.Join(cols, "\t") + "\n"))
-
+func scanAll(rows *Rows) ([][]interface{}, error) {
+	var all [][]interface{}
 	for rows.Next() {
 		var row []interface{}
 		err := rows.Scan(&row)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		all = append(all, row)
+	}
+	return all, rows.Err()
+}
+
+func writeHorizontal(buf io.Writer, cols []string, rows [][]interface{}) error {
+	t := tabwriter.NewWriter(buf, 4, 4, 2, ' ', 0)
+	t.Write([]byte(strings.Join(cols, "\t") + "\n"))
 
+	for _, row := range rows {
 		for i, c := range row {
 			t.Write([]byte(fmt.Sprintf("%v", formatParam(c, false))))
 			if i < len(row)-1 {
@@ -214,16 +270,10 @@ func dumpHorizontal(buf io.Writer, rows *Rows, cols []string) error {
 	return t.Flush()
 }
 
-func dumpVertical(buf io.Writer, rows *Rows, cols []string) error {
+func writeVertical(buf io.Writer, cols []string, rows [][]interface{}) error {
 	t := tabwriter.NewWriter(buf, 4, 4, 2, ' ', 0)
 
-	for rows.Next() {
-		var row []interface{}
-		err := rows.Scan(&row)
-		if err != nil {
-			return err
-		}
-
+	for _, row := range rows {
 		for i, c := range row {
 			t.Write([]byte(fmt.Sprintf("%s\t%v\n", cols[i], formatParam(c, false))))
 		}
@@ -232,19 +282,14 @@ func dumpVertical(buf io.Writer, rows *Rows, cols []string) error {
 	return t.Flush()
 }
 
-func dumpCSV(buf io.Writer, rows *Rows, cols []string) error {
+func writeCSV(buf io.Writer, cols []string, rows [][]interface{}) error {
 	cf := csv.NewWriter(buf)
 	err := cf.Write(cols)
 	if err != nil {
 		return err
 	}
 
-	for rows.Next() {
-		var row []interface{}
-		err := rows.Scan(&row)
-		if err != nil {
-			return err
-		}
+	for _, row := range rows {
 		rr := make([]string, 0, len(row))
 		for _, c := range row {
 			rr = append(rr, formatParam(c, false))
@@ -258,14 +303,9 @@ func dumpCSV(buf io.Writer, rows *Rows, cols []string) error {
 	return cf.Error()
 }
 
-func dumpJSON(buf *bytes.Buffer, rows *Rows, cols []string) error {
+func writeJSON(buf *bytes.Buffer, cols []string, rows [][]interface{}) error {
 	var j []map[string]interface{}
-	for rows.Next() {
-		var row []interface{}
-		err := rows.Scan(&row)
-		if err != nil {
-			return err
-		}
+	for _, row := range rows {
 		obj := make(map[string]interface{})
 		for i, c := range row {
 			obj[cols[i]] = c
@@ -281,7 +321,7 @@ func dumpJSON(buf *bytes.Buffer, rows *Rows, cols []string) error {
 	return nil
 }
 
-func dumpHTML(buf *bytes.Buffer, rows *Rows, cols []string) error {
+func writeHTML(buf *bytes.Buffer, cols []string, rows [][]interface{}) error {
 	buf.WriteString("<table><thead><tr>\n")
 	for _, c := range cols {
 		buf.WriteString("  <th>")
@@ -290,13 +330,7 @@ func dumpHTML(buf *bytes.Buffer, rows *Rows, cols []string) error {
 	}
 	buf.WriteString("</tr></thead><tbody>\n")
 
-	for rows.Next() {
-		var row []interface{}
-		err := rows.Scan(&row)
-		if err != nil {
-			return err
-		}
-
+	for _, row := range rows {
 		buf.WriteString("<tr>\n")
 		for _, r := range row {
 			buf.WriteString("  <td>")
@@ -307,12 +341,6 @@ func dumpHTML(buf *bytes.Buffer, rows *Rows, cols []string) error {
 	}
 
 	buf.WriteString("</tbody></table>\n")
-
-	// out, err := json.MarshalIndent(j, "", "\t")
-	// if err != nil {
-	// 	return err
-	// }
-	// buf.Write(out)
 	return nil
 }
 
@@ -329,12 +357,22 @@ func DumpString(ctx context.Context, query string, params ...interface{}) string
 // a consideration when writing this. Parameters in SQL are sent separately over
 // the write and are not interpolated, so it's very different.
 //
-// This supports ? placeholders and $1 placeholders *in order* ($\d+ is simply
-// replace with ?).
+// This supports ? placeholders and $1 placeholders; $n can be used more than
+// once.
 func ApplyParams(query string, params ...interface{}) string {
-	query = regexp.MustCompile(`\$\d+`).ReplaceAllString(query, "?")
-	for _, p := range params {
-		query = strings.Replace(query, "?", formatParam(p, true), 1)
+	if reDollarParam.MatchString(query) {
+		// $n can be used more than once on PostgreSQL.
+		query = reDollarParam.ReplaceAllStringFunc(query, func(m string) string {
+			n, _ := strconv.Atoi(m[1:])
+			if n < 1 || n > len(params) {
+				return m
+			}
+			return formatParam(params[n-1], true)
+		})
+	} else {
+		for _, p := range params {
+			query = strings.Replace(query, "?", formatParam(p, true), 1)
+		}
 	}
 	query = deIndent(query)
 	if !strings.HasSuffix(query, ";") {
@@ -343,11 +381,18 @@ func ApplyParams(query string, params ...interface{}) string {
 	return query
 }
 
+var reDollarParam = regexp.MustCompile(`\$\d+`)
+
 func formatParam(a interface{}, quoted bool) string {
 	if a == nil {
 		return "NULL"
 	}
 	switch aa := a.(type) {
+	case Secret:
+		if quoted {
+			return "'[redacted]'"
+		}
+		return "[redacted]"
 	case *string:
 		if aa == nil {
 			return "NULL"
@@ -453,6 +498,17 @@ func Diff(out, want string) string {
 // Everything before the first special comment is run as a "setup". The
 // "-- params" and "-- want" comments can be repeated for multiple tests.
 //
+// Parameters are as "name: value", one per line. Values in single or double
+// quotes are always a string, "null" is nil, and integers are an int64;
+// everything else is used as a string.
+//
+// The result is compared to the output of Dump() with Diff(), so leading
+// whitespace is ignored.
+//
+// Every test is run as a subtest in a transaction that's rolled back, after
+// running the setup. The database is created with StartTest(), with files as
+// ConnectOptions.Files.
+//
 // Example:
 //
 //    db/query/select-sites.sql:
@@ -462,17 +518,142 @@ func Diff(out, want string) string {
 //      insert into sites () values (...)
 //
 //      -- params
-//      site_id:    1
-//      created_at: 2020-01-01
+//      site:  1
+//      start: 2020-01-01
 //
 //      -- want
-//      1
+//      site_id  created_at
+//      1        2020-06-01 00:00:00
 //
 //      -- params
+//      site:  2
+//      start: 2020-01-01
 //
 //      -- want
+//      site_id  created_at
 func TestQueries(t *testing.T, files fs.FS) {
 	t.Helper()
 
-	// TODO
+	ctx := StartTest(t, ConnectOptions{Files: files})
+	db := MustGetDB(ctx)
+	queries := Unwrap(db).(interface{ queryFiles() fs.FS }).queryFiles()
+	if queries == nil {
+		t.Fatal("zdb.TestQueries: no query directory")
+	}
+
+	ls, err := fs.Glob(queries, "*_test.sql")
+	if err != nil {
+		t.Fatalf("zdb.TestQueries: %s", err)
+	}
+	if len(ls) == 0 {
+		t.Fatal("zdb.TestQueries: no *_test.sql files")
+	}
+
+	for _, f := range ls {
+		f := f
+		t.Run(f, func(t *testing.T) {
+			data, err := fs.ReadFile(queries, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setup, tests, err := parseQueryTest(string(data))
+			if err != nil {
+				t.Fatalf("%s: %s", f, err)
+			}
+
+			name := "load:" + strings.TrimSuffix(f, "_test.sql")
+			for i, tt := range tests {
+				tt := tt
+				t.Run(strconv.Itoa(i+1), func(t *testing.T) {
+					txctx, tx, err := Begin(ctx)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer tx.Rollback()
+
+					if strings.TrimSpace(setup) != "" {
+						err := Exec(txctx, setup)
+						if err != nil {
+							t.Fatalf("%s: running setup: %s", f, err)
+						}
+					}
+
+					have := DumpString(txctx, name, tt.params)
+					if d := Diff(strings.TrimSpace(have), tt.want); d != "" {
+						t.Errorf("%s: test %d (line %d)\n%s", f, i+1, tt.line, d)
+					}
+				})
+			}
+		})
+	}
+}
+
+type queryTest struct {
+	line   int
+	params P
+	want   string
+}
+
+// parseQueryTest parses a _test.sql file; see TestQueries().
+func parseQueryTest(data string) (string, []queryTest, error) {
+	var (
+		setup   strings.Builder
+		want    strings.Builder
+		tests   []queryTest
+		section string
+	)
+	end := func() {
+		if len(tests) > 0 {
+			tests[len(tests)-1].want = strings.TrimSpace(want.String())
+		}
+		want.Reset()
+	}
+
+	for i, line := range strings.Split(data, "\n") {
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "-- params":
+			end()
+			tests = append(tests, queryTest{line: i + 1, params: make(P)})
+			section = "params"
+			continue
+		case "-- want":
+			if len(tests) == 0 || section != "params" {
+				return "", nil, fmt.Errorf("line %d: \"-- want\" without \"-- params\"", i+1)
+			}
+			section = "want"
+			continue
+		}
+
+		switch section {
+		case "":
+			setup.WriteString(line + "\n")
+		case "want":
+			want.WriteString(line + "\n")
+		case "params":
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "--") {
+				continue
+			}
+			c := strings.IndexByte(line, ':')
+			if c == -1 {
+				return "", nil, fmt.Errorf("line %d: invalid parameter: %q", i+1, line)
+			}
+			tests[len(tests)-1].params[strings.TrimSpace(line[:c])] = parseParam(strings.TrimSpace(line[c+1:]))
+		}
+	}
+	end()
+	return setup.String(), tests, nil
+}
+
+func parseParam(v string) interface{} {
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	if v == "null" {
+		return nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	return v
 }
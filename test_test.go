@@ -2,6 +2,8 @@ package zdb
 
 import (
 	"testing"
+
+	"zgo.at/zdb/testdata"
 )
 
 func TestDump(t *testing.T) {
@@ -106,3 +108,7 @@ func TestDump(t *testing.T) {
 	}
 
 }
+
+func TestTestQueries(t *testing.T) {
+	TestQueries(t, testdata.Files)
+}
@@ -0,0 +1 @@
+select 'migrate-down';
@@ -26,7 +26,7 @@ select
 		from hit_counts
 		where site_id = :site and
 			{{:filter path_id in (:filter) and}}
-			(hour >= :start and hour <= cast(:start as timestamp) + :tz * interval '1 minute') or
-			(hour >= :end   and hour <= cast(:end   as timestamp) + :tz * interval '1 minute')
+			(hour >= :start and hour <= :start::timestamp + :tz * interval '1 minute') or
+			(hour >= :end   and hour <= :end::timestamp   + :tz * interval '1 minute')
 	) as total_unique_utc
 from x, y;
@@ -1,12 +1,16 @@
-insert into t (col) values ('x', 'a', 'aargh!');
+create table t (col varchar(255));
+insert into t (col) values ('x'), ('a'), ('aargh!');
 
 -- params
 find: 'a%'
+
 -- want
-'a'
-'aargh'
+col
+a
+aargh!
 
 -- params
 find: ''
--- want
 
+-- want
+col
@@ -0,0 +1,127 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrQueryTimeout is returned if a query took longer than the Timeout given
+// as a parameter. The error will also unwrap to the driver error.
+var ErrQueryTimeout = errors.New("query timeout")
+
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("%s after %s: %s", ErrQueryTimeout, e.timeout, e.err)
+}
+func (e timeoutError) Unwrap() error        { return e.err }
+func (e timeoutError) Is(target error) bool { return target == ErrQueryTimeout }
+
+// Get the Timeout from the parameters and the parameters without the Timeout;
+// if there are multiple then the last one is used.
+func splitTimeout(params []interface{}) (time.Duration, []interface{}, bool) {
+	var (
+		t   Timeout
+		has bool
+	)
+	for _, p := range params {
+		if tt, ok := p.(Timeout); ok {
+			t, has = tt, true
+		}
+	}
+	if !has {
+		return 0, params, false
+	}
+
+	rest := make([]interface{}, 0, len(params)-1)
+	for _, p := range params {
+		if _, ok := p.(Timeout); !ok {
+			rest = append(rest, p)
+		}
+	}
+	return time.Duration(t), rest, t > 0
+}
+
+// withTimeout runs fn with the timeout applied.
+//
+// This sets a context deadline, and on PostgreSQL also sets statement_timeout
+// for the query, so the server will stop it even if the cancellation doesn't
+// arrive. This needs a transaction; one is started if we're not in one
+// already, which means a begin, set, and commit for every query.
+func withTimeout(ctx context.Context, db DB, timeout time.Duration, fn func(context.Context, DB) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err error
+	if db.Driver() == DriverPostgreSQL {
+		err = withStatementTimeout(ctx, db, timeout, fn)
+	} else {
+		err = fn(ctx, db)
+	}
+	return timeoutErr(ctx, timeout, err)
+}
+
+func withStatementTimeout(ctx context.Context, db DB, timeout time.Duration, fn func(context.Context, DB) error) error {
+	ms := int64(timeout / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	set := "set local statement_timeout = " + strconv.FormatInt(ms, 10)
+
+	if tx, ok := Unwrap(db).(*zTX); ok {
+		// Keep any statement_timeout the caller set in this transaction.
+		var prev string
+		err := tx.db.GetContext(ctx, &prev, `select current_setting('statement_timeout')`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.db.ExecContext(ctx, set)
+		if err != nil {
+			return err
+		}
+		err = fn(ctx, db)
+		// Restore for the rest of the transaction; this will fail if the query
+		// failed and the transaction is aborted, which is fine.
+		_, _ = tx.db.ExecContext(context.Background(), `select set_config('statement_timeout', $1, true)`, prev)
+		return err
+	}
+
+	txctx, txdb, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer txdb.Rollback()
+
+	_, err = Unwrap(txdb).(*zTX).db.ExecContext(txctx, set)
+	if err != nil {
+		return err
+	}
+	err = fn(txctx, txdb)
+	if err != nil {
+		return err
+	}
+	return txdb.Commit()
+}
+
+// Wrap err if it's caused by the timeout.
+func timeoutErr(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutError{timeout: timeout, err: err}
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" { // query_canceled
+		return timeoutError{timeout: timeout, err: err}
+	}
+	return err
+}
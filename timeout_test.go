@@ -0,0 +1,136 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitTimeout(t *testing.T) {
+	tests := []struct {
+		in       []interface{}
+		wantT    time.Duration
+		wantRest []interface{}
+		wantOK   bool
+	}{
+		{nil, 0, nil, false},
+		{L{1, "a"}, 0, L{1, "a"}, false},
+		{L{1, Timeout(time.Second), "a"}, time.Second, L{1, "a"}, true},
+		{L{Timeout(time.Second), Timeout(2 * time.Second)}, 2 * time.Second, L{}, true},
+		{L{1, Timeout(0)}, 0, L{1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			d, rest, ok := splitTimeout(tt.in)
+			if d != tt.wantT || ok != tt.wantOK || !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("\nhave: %s %#v %t\nwant: %s %#v %t", d, rest, ok, tt.wantT, tt.wantRest, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ctx := StartTest(t)
+
+	slow := map[DriverType]string{
+		DriverSQLite:     `with recursive c(x) as (select 1 union all select x+1 from c where x < 1e9) select count(*) from c`,
+		DriverPostgreSQL: `select pg_sleep(1)`,
+		DriverMariaDB:    `select sleep(1)`,
+	}[Driver(ctx)]
+
+	t.Run("timeout", func(t *testing.T) {
+		var n int
+		start := time.Now()
+		err := Get(ctx, &n, slow, Timeout(20*time.Millisecond))
+		if !errors.Is(err, ErrQueryTimeout) {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if took := time.Since(start); took > 500*time.Millisecond {
+			t.Errorf("took %s", took)
+		}
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		var n int
+		err := Get(ctx, &n, `select :x`, P{"x": 42}, Timeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 42 {
+			t.Errorf("n = %d", n)
+		}
+
+		err = Exec(ctx, `create table t (i int)`, Timeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = TX(ctx, func(ctx context.Context) error {
+			return Exec(ctx, `insert into t values (1)`, Timeout(time.Second))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := Query(ctx, `select i from t`, Timeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var is []int
+		for rows.Next() {
+			var r struct{ I int }
+			if err := rows.Scan(&r); err != nil {
+				t.Fatal(err)
+			}
+			is = append(is, r.I)
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(is, []int{1}) {
+			t.Errorf("%v", is)
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		err := Exec(ctx, `select * from nonexistent`, Timeout(time.Second))
+		if err == nil || errors.Is(err, ErrQueryTimeout) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	})
+}
+
+func TestTimeoutRestore(t *testing.T) {
+	ctx := StartTest(t)
+	if Driver(ctx) != DriverPostgreSQL {
+		t.Skip("statement_timeout is PostgreSQL-only")
+	}
+
+	err := TX(ctx, func(ctx context.Context) error {
+		err := Exec(ctx, `set local statement_timeout = 5000`)
+		if err != nil {
+			return err
+		}
+
+		var n int
+		err = Get(ctx, &n, `select 1`, Timeout(time.Second))
+		if err != nil {
+			return err
+		}
+
+		var have string
+		err = Get(ctx, &have, `select current_setting('statement_timeout')`)
+		if err != nil {
+			return err
+		}
+		if have != "5s" {
+			t.Errorf("statement_timeout = %q", have)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
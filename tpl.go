@@ -13,23 +13,78 @@ var SchemaFuncMap template.FuncMap
 
 // SchemaTemplate runs text/template on the database schema to make writing
 // compatible schemas a bit easier.
+//
+// The following functions are available in addition to the text/template
+// defaults; functions that return a column type are padded with spaces so
+// columns can be aligned:
+//
+//   sqlite "s"               Only include s for SQLite.
+//   psql "s"                 Only include s for PostgreSQL.
+//   mysql "s"                Only include s for MariaDB.
+//   auto_increment           Auto-incrementing primary key.
+//   jsonb                    JSON column type.
+//   blob                     Binary column type.
+//   bool                     Boolean column type.
+//   timestamp                Timestamp column type (datetime on MariaDB).
+//   uuid                     UUID column type.
+//   text                     Text column type.
+//   now                      Current timestamp, for use in defaults.
+//   check_timestamp "col"    Check the column contains a timestamp (SQLite, MariaDB).
+//   check_date "col"         Check the column contains a date (SQLite, MariaDB).
+//   cluster "tbl" "idx"      Cluster table on an index (PostgreSQL).
+//   replica "tbl" "idx"      Set the replica identity (PostgreSQL).
+//
+// cluster and replica are empty for MariaDB: InnoDB tables are always clustered
+// on the primary key, and replication doesn't need a replica identity.
+//   create_index_if_not_exists "name" "tbl" "cols"
+//                            Create an index, unless it exists already.
 func SchemaTemplate(driver DriverType, tpl string) ([]byte, error) {
+	return schemaTemplate("zdb.SchemaTemplate", driver, tpl, nil)
+}
+
+// SchemaTemplateData is like SchemaTemplate(), but with data passed to the
+// template.
+//
+// This is what's used for the TemplateData in ConnectOptions and
+// Migrate.TemplateData().
+func SchemaTemplateData(driver DriverType, tpl string, data interface{}) ([]byte, error) {
+	return schemaTemplate("zdb.SchemaTemplateData", driver, tpl, data)
+}
+
+func schemaTemplate(fn string, driver DriverType, tpl string, data interface{}) ([]byte, error) {
 	t, err := template.New("").Funcs(tplFuncs(driver)).Parse(tpl)
 	if err != nil {
-		return nil, fmt.Errorf("zdb.SchemaTemplate: %w", err)
+		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
 
 	buf := new(bytes.Buffer)
-	err = t.Execute(buf, nil)
+	err = t.Execute(buf, data)
 	if err != nil {
-		return nil, fmt.Errorf("zdb.SchemaTemplate: %w", err)
+		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
 	b := regexp.MustCompile(` +\n`).ReplaceAll(buf.Bytes(), []byte("\n"))
 	return b, nil
 }
 
+// queryTemplate runs text/template on a query loaded with Load().
+//
+// This uses {% .. %} as delimiters, as {{ .. }} is already used for
+// conditionals. Errors aren't prefixed, as Load() already adds that.
+func queryTemplate(driver DriverType, name string, tpl []byte, data interface{}) ([]byte, error) {
+	t, err := template.New(name).Delims("{%", "%}").Funcs(tplFuncs(driver)).Parse(string(tpl))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = t.Execute(buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func tplFuncs(driver DriverType) template.FuncMap {
-	// TODO: MariaDB for many of these.
 	f := template.FuncMap{
 		"sqlite": func(s string) string { return map[DriverType]string{DriverSQLite: s}[driver] },
 		"psql":   func(s string) string { return map[DriverType]string{DriverPostgreSQL: s}[driver] },
@@ -38,38 +93,89 @@ func tplFuncs(driver DriverType) template.FuncMap {
 			return map[DriverType]string{
 				DriverPostgreSQL: "serial         primary key",
 				DriverSQLite:     "integer        primary key autoincrement",
+				DriverMariaDB:    "integer        primary key auto_increment",
 			}[driver]
 		},
 		"jsonb": func() string {
 			return map[DriverType]string{
 				DriverPostgreSQL: "jsonb    ",
 				DriverSQLite:     "varchar  ",
+				DriverMariaDB:    "json     ",
 			}[driver]
 		},
 		"blob": func() string {
 			return map[DriverType]string{
 				DriverPostgreSQL: "bytea   ",
 				DriverSQLite:     "blob    ",
+				DriverMariaDB:    "longblob",
+			}[driver]
+		},
+		"bool": func() string {
+			return map[DriverType]string{
+				DriverPostgreSQL: "boolean  ",
+				DriverSQLite:     "integer  ",
+				DriverMariaDB:    "boolean  ",
+			}[driver]
+		},
+		// MariaDB's timestamp only goes up to 2038, and automatically updates
+		// on row changes in some configurations.
+		"timestamp": func() string {
+			return map[DriverType]string{
+				DriverPostgreSQL: "timestamp",
+				DriverSQLite:     "timestamp",
+				DriverMariaDB:    "datetime ",
+			}[driver]
+		},
+		"uuid": func() string {
+			return map[DriverType]string{
+				DriverPostgreSQL: "uuid     ",
+				DriverSQLite:     "varchar  ",
+				DriverMariaDB:    "char(36) ",
+			}[driver]
+		},
+		"text": func() string {
+			return map[DriverType]string{
+				DriverPostgreSQL: "varchar  ",
+				DriverSQLite:     "varchar  ",
+				DriverMariaDB:    "text     ",
+			}[driver]
+		},
+		"now": func() string {
+			return map[DriverType]string{
+				DriverPostgreSQL: "now()",
+				DriverSQLite:     "current_timestamp",
+				DriverMariaDB:    "current_timestamp()",
 			}[driver]
 		},
 		"check_timestamp": func(col string) string {
 			return map[DriverType]string{
-				DriverSQLite: "check(" + col + " = strftime('%Y-%m-%d %H:%M:%S', " + col + "))",
+				DriverSQLite:  "check(" + col + " = strftime('%Y-%m-%d %H:%M:%S', " + col + "))",
+				DriverMariaDB: "check(" + col + " = date_format(" + col + ", '%Y-%m-%d %H:%i:%s'))",
 			}[driver]
 		},
 		"check_date": func(col string) string {
 			return map[DriverType]string{
-				DriverSQLite: "check(" + col + " = strftime('%Y-%m-%d', " + col + "))",
+				DriverSQLite:  "check(" + col + " = strftime('%Y-%m-%d', " + col + "))",
+				DriverMariaDB: "check(" + col + " = date_format(" + col + ", '%Y-%m-%d'))",
 			}[driver]
 		},
 		"cluster": func(tbl, idx string) string {
 			return map[DriverType]string{
 				DriverPostgreSQL: `cluster ` + tbl + ` using "` + idx + `";`,
+				DriverMariaDB:    ``, // Always clustered on the primary key.
 			}[driver]
 		},
 		"replica": func(tbl, idx string) string {
 			return map[DriverType]string{
 				DriverPostgreSQL: `alter table ` + tbl + ` replica identity using index "` + idx + `";`,
+				DriverMariaDB:    ``, // Not needed for replication.
+			}[driver]
+		},
+		"create_index_if_not_exists": func(name, tbl, cols string) string {
+			return map[DriverType]string{
+				DriverPostgreSQL: `create index if not exists "` + name + `" on ` + tbl + `(` + cols + `);`,
+				DriverSQLite:     `create index if not exists "` + name + `" on ` + tbl + `(` + cols + `);`,
+				DriverMariaDB:    "create index if not exists `" + name + "` on " + tbl + `(` + cols + `);`,
 			}[driver]
 		},
 	}
@@ -10,10 +10,17 @@ func TestSchemaTemplate(t *testing.T) {
 	const testSchema = `
 create table x (
 	x_id        {{auto_increment}},
-	created_at  timestamp      {{check_date "created_at"}}
+	name        {{text}} not null,
+	flag        {{bool}} not null default true,
+	created_at  {{timestamp}}      {{check_date "created_at"}},
+	updated_at  {{timestamp}}      {{check_timestamp "updated_at"}}
 );
+{{create_index_if_not_exists "x#name" "x" "name"}}
+{{cluster "x" "x#name"}}
+{{replica "x" "x#name"}}
 {{sqlite "SQLITE"}}
 {{psql "PSQL"}}
+{{mysql "MYSQL"}}
 `
 
 	tests := []struct {
@@ -23,17 +30,44 @@ create table x (
 		{DriverSQLite, `
 create table x (
 	x_id        integer        primary key autoincrement,
-	created_at  timestamp      check(created_at = strftime('%Y-%m-%d', created_at))
+	name        varchar   not null,
+	flag        integer   not null default true,
+	created_at  timestamp      check(created_at = strftime('%Y-%m-%d', created_at)),
+	updated_at  timestamp      check(updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at))
 );
+create index if not exists "x#name" on x(name);
+
+
 SQLITE
 	`},
 		{DriverPostgreSQL, `
 create table x (
 	x_id        serial         primary key,
-	created_at  timestamp
+	name        varchar   not null,
+	flag        boolean   not null default true,
+	created_at  timestamp      ,
+	updated_at  timestamp
 );
+create index if not exists "x#name" on x(name);
+cluster x using "x#name";
+alter table x replica identity using index "x#name";
 
 PSQL
+`},
+		{DriverMariaDB, `
+create table x (
+	x_id        integer        primary key auto_increment,
+	name        text      not null,
+	flag        boolean   not null default true,
+	created_at  datetime       check(created_at = date_format(created_at, '%Y-%m-%d')),
+	updated_at  datetime       check(updated_at = date_format(updated_at, '%Y-%m-%d %H:%i:%s'))
+);
+create index if not exists ` + "`x#name`" + ` on x(name);
+
+
+
+
+MYSQL
 `},
 	}
 
@@ -51,3 +85,16 @@ PSQL
 		})
 	}
 }
+
+func TestSchemaTemplateData(t *testing.T) {
+	got, err := SchemaTemplateData(DriverSQLite,
+		`create table {{.Prefix}}x (c {{text}}, t {{timestamp}} default {{now}});`,
+		struct{ Prefix string }{"pre_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `create table pre_x (c varchar  , t timestamp default current_timestamp);`
+	if string(got) != want {
+		t.Errorf("\ngot:  %s\nwant: %s", string(got), want)
+	}
+}
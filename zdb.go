@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -63,10 +64,49 @@ type (
 	// value is safe.
 	SQL string
 
+	// Identifier is a table or column name that will be quoted and inserted in
+	// the query, rather than passed as a parameter; use Ident() to create it.
+	Identifier []string
+
+	// Timeout can be added as a parameter to set a timeout for the query; for
+	// example:
+	//
+	//   zdb.Select(ctx, &rows, `select [..]`, zdb.P{"site": 1}, zdb.Timeout(2*time.Second))
+	//
+	// The query is cancelled if it takes longer, and an error matching
+	// ErrQueryTimeout with errors.Is() is returned.
+	//
+	// On PostgreSQL this also sets statement_timeout for the query. This needs
+	// a transaction, so outside of a transaction every query with a Timeout is
+	// run in its own transaction, which adds a few round-trips to the server.
+	// Inside a transaction the previous statement_timeout is restored after the
+	// query. This isn't done for Query(), as the rows are read after it
+	// returns.
+	Timeout time.Duration
+
 	// DriverType is the SQL driver.
 	DriverType uint8
+
+	// Truther is used to check if a parameter is "true" in a {{:name ..}}
+	// conditional. Types that don't implement this are checked with some
+	// defaults; see Prepare().
+	Truther interface {
+		IsTrue() bool
+	}
 )
 
+// Ident creates a new identifier (such as a table or column name) to use as a
+// parameter; this will be quoted for the driver and inserted in the query:
+//
+//   zdb.Select(ctx, &rows, `select * from t order by :col`, zdb.P{
+//       "col": zdb.Ident(userInput),
+//   })
+//
+// Multiple parts are joined with a ".", for example Ident("schema", "table")
+// for PostgreSQL becomes "schema"."table". Parts can't be empty, can't contain
+// NUL bytes, and can't be longer than the maximum the driver allows.
+func Ident(parts ...string) Identifier { return Identifier(parts) }
+
 func (d DriverType) String() string {
 	switch d {
 	case DriverSQLite:
@@ -98,13 +138,36 @@ var ErrTransactionStarted = errors.New("transaction already started")
 // multiple structs or maps, but mixing named and positional parameters is not
 // allowed.
 //
+// Named parameters in string literals, quoted identifiers, and comments are
+// ignored, and "::" is left as-is so PostgreSQL casts such as :start::timestamp
+// work. A parameter can be used more than once; on PostgreSQL this will send
+// the value only once and re-use the same $n. It's an error if a parameter is
+// missing; unused parameters are an error if StrictParams is set in
+// ConnectOptions.
+//
 // Everything between {{:name ..}} is parsed as a conditional; for example
 // {{:foo query}} will only be added if "foo" from params is true or not a zero
 // type. Conditionals only work with named parameters.
 //
+// Conditionals can be negated with {{:foo! query}}, have an else part with
+// {{:foo query | else-query}}, combine parameters with && and || ({{:foo &&
+// bar! query}}), and can be nested. The " | " needs to have whitespace on both
+// sides; use "a|b" if you want a bitwise or inside a conditional. Any
+// whitespace left over from removed conditionals is collapsed.
+//
+// Parameters are true if they implement Truther and IsTrue() returns true, or
+// are non-zero according to the following rules: types with an IsZero()
+// method (such as time.Time) use that, driver.Valuer types (such as
+// sql.NullString) use the returned value, nil pointers are false, numbers are
+// true if > 0 (!= 0 for unsigned), and strings, slices, and maps are true if
+// they're not empty. A parameter that doesn't exist is false, unless
+// StrictConditionals is set in ConnectOptions, in which case it's an error.
+//
 // If the query starts with "load:" then it's loaded from the filesystem or
 // embedded files; see Load() for details.
 //
+// A Timeout can be added to set a timeout for the query.
+//
 // Additional DumpArgs can be added to dump the results of the query to stderr
 // for testing and debugging:
 //
@@ -135,6 +198,20 @@ func Prepare(ctx context.Context, query string, params ...interface{}) (string,
 // This allows identifying queries in logging and statistics such as
 // pg_stat_statements.
 //
+// Files ending with .gotxt are run through text/template first, with the same
+// functions as SchemaTemplate() and the TemplateData from ConnectOptions. This
+// uses {% .. %} as delimiters so it doesn't clash with conditionals:
+//
+//   select * from users where
+//     email {%psql "ilike"%}{%sqlite "like"%}{%mysql "like"%} :email
+//     {{:site and site_id = :site}}
+//
+// Note that .gotxt files aren't driver-specific, and "name-{driver}.sql" files
+// take precedence.
+//
+// Loaded queries are cached; see QueryCache and ReloadQueries in
+// ConnectOptions. Use ValidateQueries() to load all queries on startup.
+//
 // Typical usage with Query() is to use "load:name", instead of calling this
 // directly:
 //
@@ -229,14 +306,70 @@ func Query(ctx context.Context, query string, params ...interface{}) (*Rows, err
 	return queryImpl(ctx, MustGetDB(ctx), query, params...)
 }
 
-type Rows struct{ r *sqlx.Rows }
+type Rows struct {
+	r      *sqlx.Rows
+	cancel context.CancelFunc // Set if there's a Timeout.
+
+	// Set if a LogDB wants the rows that were read; called on Close().
+	tee     func(cols []string, rows [][]interface{})
+	teeCols []string
+	teeRows [][]interface{}
+	teeNext bool // Current row isn't recorded yet.
+
+	// Set if a MetricsDB wants the number of rows that were read; called on
+	// Close().
+	count func(n int64)
+	n     int64
+}
+
+func (r *Rows) Next() bool {
+	ok := r.r.Next()
+	r.teeNext = ok && r.tee != nil
+	if ok {
+		r.n++
+	}
+	return ok
+}
+func (r *Rows) Err() error { return r.r.Err() }
+func (r *Rows) Close() error {
+	if r.cancel != nil {
+		defer r.cancel()
+	}
+	if r.count != nil {
+		count := r.count
+		r.count = nil
+		count(r.n)
+	}
+	if r.tee == nil {
+		return r.r.Close()
+	}
 
-func (r *Rows) Next() bool                              { return r.r.Next() }
-func (r *Rows) Err() error                              { return r.r.Err() }
-func (r *Rows) Close() error                            { return r.r.Close() }
+	if r.teeCols == nil {
+		r.teeCols, _ = r.r.Columns()
+	}
+	err := r.r.Close()
+	tee := r.tee
+	r.tee = nil
+	tee(r.teeCols, r.teeRows)
+	return err
+}
 func (r *Rows) Columns() ([]string, error)              { return r.r.Columns() }
 func (r *Rows) ColumnTypes() ([]*sql.ColumnType, error) { return r.r.ColumnTypes() }
 func (r *Rows) Scan(dest ...interface{}) error {
+	if r.teeNext {
+		// Scan() can be called more than once for the same row; only record
+		// it the first time.
+		row, err := r.r.SliceScan()
+		if err != nil {
+			return err
+		}
+		if r.teeCols == nil {
+			r.teeCols, _ = r.r.Columns()
+		}
+		r.teeRows = append(r.teeRows, row)
+		r.teeNext = false
+	}
+
 	if len(dest) > 1 {
 		return r.r.Scan(dest...)
 	}
@@ -4,23 +4,61 @@ package zdb
 
 import (
 	"errors"
+	"strings"
 
-	"github.com/lib/pq"
 	"github.com/mattn/go-sqlite3"
 )
 
-// ErrUnique reports if this error reports a UNIQUE constraint violation.
+// https://www.sqlite.org/rescode.html
 //
-// This is the cgo version which works for PostgreSQL and SQLite.
-func ErrUnique(err error) bool {
+// SQLite doesn't have separate fields for the constraint etc. so we need to get
+// it from the message, which looks like:
+//
+//   UNIQUE constraint failed: tbl.col1, tbl.col2
+//   NOT NULL constraint failed: tbl.col
+//   CHECK constraint failed: name
+func classifySQLite(err error) *Error {
 	var sqlErr sqlite3.Error
-	if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-		return true
+	if !errors.As(err, &sqlErr) {
+		return nil
+	}
+
+	e := &Error{Err: err}
+	switch sqlErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		e.Kind = KindUnique
+	case sqlite3.ErrConstraintForeignKey:
+		e.Kind = KindForeignKey
+	case sqlite3.ErrConstraintNotNull:
+		e.Kind = KindNotNull
+	case sqlite3.ErrConstraintCheck:
+		e.Kind = KindCheck
+	default:
+		switch sqlErr.Code {
+		case sqlite3.ErrLocked:
+			e.Kind = KindDeadlock
+		case sqlite3.ErrBusy, sqlite3.ErrInterrupt:
+			e.Kind = KindTimeout
+		case sqlite3.ErrReadonly:
+			e.Kind = KindReadOnly
+		}
 	}
-	var pqErr *pq.Error
-	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
-		return true
+
+	msg := sqlErr.Error()
+	if i := strings.Index(msg, "constraint failed: "); i > -1 {
+		detail := msg[i+19:]
+		switch e.Kind {
+		case KindCheck:
+			e.Constraint = detail
+		case KindUnique, KindNotNull:
+			// Only report the first column for multi-column constraints.
+			if i := strings.Index(detail, ", "); i > -1 {
+				detail = detail[:i]
+			}
+			if i := strings.IndexByte(detail, '.'); i > -1 {
+				e.Table, e.Column = detail[:i], detail[i+1:]
+			}
+		}
 	}
-	// TODO: mysql
-	return false
+	return e
 }
@@ -61,9 +61,21 @@ type zDB struct {
 	db      *sqlx.DB
 	driver  DriverType
 	queryFS fs.FS
+	qcache  *queryCache
+	tplData interface{}
+	strict  bool
+	sparams bool
+	arrays  bool
+	stmts   *stmtCache
 }
 
-func (db zDB) queryFiles() fs.FS { return db.queryFS }
+func (db zDB) queryFiles() fs.FS         { return db.queryFS }
+func (db zDB) queryCache() *queryCache   { return db.qcache }
+func (db zDB) templateData() interface{} { return db.tplData }
+func (db zDB) strictConditionals() bool  { return db.strict }
+func (db zDB) strictParams() bool        { return db.sparams }
+func (db zDB) bindArrays() bool          { return db.arrays }
+func (db zDB) stmtCache() *stmtCache     { return db.stmts }
 
 func (db zDB) DBSQL() *sql.DB                               { return db.db.DB }
 func (db zDB) Driver() DriverType                           { return db.driver }
@@ -97,7 +109,10 @@ func (db zDB) BindNamed(query string, param interface{}) (newquery string, param
 }
 func (db zDB) Rebind(query string) string { return db.db.Rebind(query) }
 func (db zDB) DriverName() string         { return db.db.DriverName() }
-func (db zDB) Close() error               { return db.db.Close() }
+func (db zDB) Close() error {
+	db.stmts.close()
+	return db.db.Close()
+}
 func (db zDB) Begin(ctx context.Context, opts ...beginOpt) (context.Context, DB, error) {
 	return beginImpl(ctx, &db, opts...)
 }
@@ -108,24 +123,64 @@ func (db zDB) TX(ctx context.Context, fn func(context.Context) error) error {
 }
 
 func (db zDB) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return nil, err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.ExecContext(ctx, params...)
+	}
 	return db.db.ExecContext(ctx, query, params...)
 }
 func (db zDB) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.GetContext(ctx, dest, params...)
+	}
 	return db.db.GetContext(ctx, dest, query, params...)
 }
 func (db zDB) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.SelectContext(ctx, dest, params...)
+	}
 	return db.db.SelectContext(ctx, dest, query, params...)
 }
 func (db zDB) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	if db.stmts != nil && cacheable(query) {
+		// Rows keep the statement alive after release() until they're closed.
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return nil, err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.QueryxContext(ctx, params...)
+	}
 	return db.db.QueryxContext(ctx, query, params...)
 }
 
 type zTX struct {
 	db     *sqlx.Tx
-	parent *zDB // Needed for Close() and queryFiles()
+	parent *zDB       // Needed for Close() and the unexported methods above.
+	stmts  *stmtCache // nil if the statement cache is disabled.
 }
 
-func (db zTX) queryFiles() fs.FS { return db.parent.queryFiles() }
+func (db zTX) queryFiles() fs.FS         { return db.parent.queryFiles() }
+func (db zTX) queryCache() *queryCache   { return db.parent.queryCache() }
+func (db zTX) templateData() interface{} { return db.parent.templateData() }
+func (db zTX) strictConditionals() bool  { return db.parent.strictConditionals() }
+func (db zTX) strictParams() bool        { return db.parent.strictParams() }
+func (db zTX) bindArrays() bool          { return db.parent.bindArrays() }
+func (db zTX) stmtCache() *stmtCache     { return db.parent.stmtCache() }
 
 func (db zTX) DBSQL() *sql.DB                               { return db.parent.DBSQL() }
 func (db zTX) Driver() DriverType                           { return db.parent.driver }
@@ -177,15 +232,47 @@ func (db zTX) TX(ctx context.Context, fn func(context.Context) error) error {
 }
 
 func (db zTX) ExecContext(ctx context.Context, query string, params ...interface{}) (sql.Result, error) {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return nil, err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.ExecContext(ctx, params...)
+	}
 	return db.db.ExecContext(ctx, query, params...)
 }
 func (db zTX) GetContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.GetContext(ctx, dest, params...)
+	}
 	return db.db.GetContext(ctx, dest, query, params...)
 }
 func (db zTX) SelectContext(ctx context.Context, dest interface{}, query string, params ...interface{}) error {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.SelectContext(ctx, dest, params...)
+	}
 	return db.db.SelectContext(ctx, dest, query, params...)
 }
 func (db zTX) QueryxContext(ctx context.Context, query string, params ...interface{}) (*sqlx.Rows, error) {
+	if db.stmts != nil && cacheable(query) {
+		s, err := db.stmts.get(ctx, db.db, query)
+		if err != nil {
+			return nil, err
+		}
+		defer db.stmts.release(s)
+		return s.stmt.QueryxContext(ctx, params...)
+	}
 	return db.db.QueryxContext(ctx, query, params...)
 }
 
@@ -218,38 +305,66 @@ func versionImpl(ctx context.Context) (Version, error) {
 }
 
 func prepareImpl(ctx context.Context, db DB, query string, params ...interface{}) (string, []interface{}, error) {
+	query, params, _, err := prepareNames(ctx, db, query, params...)
+	return query, params, err
+}
+
+// prepareNames is like prepareImpl, but also returns the parameter names for
+// named parameters; this is nil for positional parameters, or if the names
+// can't be known (e.g. when a slice was expanded).
+func prepareNames(ctx context.Context, db DB, query string, params ...interface{}) (string, []interface{}, *paramNames, error) {
 	merged, named, dumpArgs, dumpOut, err := prepareParams(params)
 	if err != nil {
-		return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+		return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 	}
 
 	if strings.HasPrefix(query, "load:") {
 		query, err = Load(ctx, query[5:])
 		if err != nil {
-			return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+			return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 		}
 	}
 
 	if named {
-		query, err = replaceConditionals(query, merged)
+		if Unwrap(db).(interface{ strictParams() bool }).strictParams() {
+			err := unusedParams(db.Driver(), query, params)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
+			}
+		}
+
+		strict := Unwrap(db).(interface{ strictConditionals() bool }).strictConditionals()
+		query, err = replaceConditionals(query, strict, merged)
 		if err != nil {
-			return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+			return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 		}
 	}
 
-	qparams, _ := merged.([]interface{})
+	// pos has the byte offsets of the ? placeholders, so that ? in string
+	// literals and comments are left alone.
+	var (
+		qparams, _ = merged.([]interface{})
+		names      []string
+		pos        []int
+	)
 	if named {
-		var err error
-		query, qparams, err = sqlx.Named(query, merged)
+		query, names, pos = compileNamed(db.Driver(), query)
+		qparams, err = bindNamed(names, merged.(map[string]interface{}))
 		if err != nil {
-			return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+			return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 		}
+	} else {
+		pos = findPlaceholders(db.Driver(), query)
 	}
 
-	// Sprintf SQL types and []int slices directly in the query. This solves two
-	// cases:
+	// Sprintf SQL types, identifiers, and []int slices directly in the query.
+	// This solves two cases:
 	// - IN (...) with a lot of parameters.
 	// - Things like generated SQL (i.e. "interval ...") that shouldn't be escaped.
+	//
+	// If BindArrays is set then slices in "in (?)" are sent as one parameter
+	// instead.
+	arrays := Unwrap(db).(interface{ bindArrays() bool }).bindArrays()
 	var rm []int
 	for i := len(qparams) - 1; i >= 0; i-- {
 		// These are aliases of []uint8 and []int32; there isn't really any way
@@ -261,19 +376,43 @@ func prepareImpl(ctx context.Context, db DB, query string, params ...interface{}
 			continue
 		}
 
+		if id, ok := qparams[i].(Identifier); ok {
+			q, err := id.quote(db.Driver())
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
+			}
+			query, err = replaceParam(query, pos, i, SQL(q))
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
+			}
+			rm = append(rm, i)
+			continue
+		}
+
+		if arrays {
+			var ok bool
+			query, qparams[i], ok, err = bindArray(db.Driver(), query, pos, i, qparams[i])
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
+			}
+			if ok {
+				continue
+			}
+		}
+
 		if s, ok := qparams[i].(SQL); ok {
-			query, err = replaceParam(query, i, s)
+			query, err = replaceParam(query, pos, i, s)
 			if err != nil {
-				return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 			}
 			rm = append(rm, i)
 			continue
 		}
 
 		if s, ok := zint.ToIntSlice(qparams[i]); ok {
-			query, err = replaceParam(query, i, SQL(zint.Join64(s, ", ")))
+			query, err = replaceParam(query, pos, i, SQL(zint.Join64(s, ", ")))
 			if err != nil {
-				return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+				return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
 			}
 			rm = append(rm, i)
 		}
@@ -281,44 +420,163 @@ func prepareImpl(ctx context.Context, db DB, query string, params ...interface{}
 
 	for _, i := range rm {
 		qparams = append(qparams[:i], qparams[i+1:]...)
+		pos = append(pos[:i], pos[i+1:]...)
+		if names != nil {
+			names = append(names[:i], names[i+1:]...)
+		}
 	}
 
-	query, qparams, err = sqlx.In(query, qparams...)
+	var expanded bool
+	query, pos, qparams, expanded, err = expandIn(query, pos, qparams)
 	if err != nil {
-		return "", nil, fmt.Errorf("zdb.Prepare: %w", err)
+		return "", nil, nil, fmt.Errorf("zdb.Prepare: %w", err)
+	}
+
+	// We don't know which name belongs to which parameter if any slices were
+	// expanded.
+	var pn *paramNames
+	if expanded {
+		names = nil
+	}
+	if named && names != nil && len(names) == len(qparams) {
+		pn = &paramNames{names: names, secret: secretNames(params)}
+	}
+
+	// Use the same $n for repeated named parameters on PostgreSQL.
+	rebound := false
+	if db.Driver() == DriverPostgreSQL {
+		query, qparams, rebound = rebindNamed(query, pos, names, qparams)
+		if rebound && pn != nil {
+			pn.names = uniqNames(names)
+		}
+	}
+	if !rebound {
+		query = db.Rebind(query)
 	}
-	query = db.Rebind(query)
 
 	if dumpArgs > 0 {
 		if dumpOut == nil {
 			dumpOut = stderr
 		}
-		Dump(ctx, dumpOut, query, append(qparams, dumpArgs)...)
+		Dump(withParamNames(ctx, pn), dumpOut, query, append(qparams, dumpArgs)...)
 	}
 
-	return query, qparams, nil
+	return query, qparams, pn, nil
 }
 
-func replaceParam(query string, n int, param SQL) (string, error) {
-	i := zstring.IndexN(query, "?", uint(n+1))
-	if i == -1 {
+// Replace the nth placeholder with param; the offset is removed from pos by the
+// caller.
+func replaceParam(query string, pos []int, n int, param SQL) (string, error) {
+	if n >= len(pos) {
 		return "", fmt.Errorf("not enough parameters")
 	}
-	return query[:i] + string(param) + query[i+1:], nil
+	return splice(query, pos, pos[n], pos[n]+1, string(param)), nil
 }
 
-// TODO: this could be cached, but if the FS is an os.DirFS then it may have
-// changes on the filesystem (being able to change queries w/o recompile is
-// nice).
+// expandIn expands slice parameters to "?, ?, ?" like sqlx.In(), using the
+// placeholder offsets in pos rather than every ? in the query.
 //
-// TODO: implement .gotxt support here too? The {{ .. }} from our own syntax
-// will clash though.
+// This returns false if there was nothing to expand.
+func expandIn(query string, pos []int, params []interface{}) (string, []int, []interface{}, bool, error) {
+	var (
+		args   = make([]interface{}, len(params))
+		expand bool
+	)
+	for i, p := range params {
+		if v, ok := p.(driver.Valuer); ok {
+			var err error
+			p, err = v.Value()
+			if err != nil {
+				return "", nil, nil, false, err
+			}
+		}
+		args[i] = p
+		if s, ok := inSlice(p); ok {
+			if s.Len() == 0 {
+				return "", nil, nil, false, errors.New("empty slice passed to 'in' query")
+			}
+			expand = true
+		}
+	}
+	if !expand {
+		return query, pos, params, false, nil
+	}
+	if len(pos) != len(params) {
+		return "", nil, nil, false, fmt.Errorf("%d placeholders and %d parameters", len(pos), len(params))
+	}
+
+	var (
+		b       strings.Builder
+		npos    = make([]int, 0, len(pos))
+		nparams = make([]interface{}, 0, len(params))
+		last    int
+	)
+	b.Grow(len(query) + len(params)*3)
+	for k, i := range pos {
+		b.WriteString(query[last:i])
+		last = i + 1
+
+		s, ok := inSlice(args[k])
+		if !ok {
+			npos = append(npos, b.Len())
+			b.WriteByte('?')
+			nparams = append(nparams, args[k])
+			continue
+		}
+		for j := 0; j < s.Len(); j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			npos = append(npos, b.Len())
+			b.WriteByte('?')
+			nparams = append(nparams, s.Index(j).Interface())
+		}
+	}
+	b.WriteString(query[last:])
+	return b.String(), npos, nparams, true, nil
+}
+
+// Get the slice to expand for "in (?)"; []byte is never expanded.
+func inSlice(p interface{}) (reflect.Value, bool) {
+	if p == nil {
+		return reflect.Value{}, false
+	}
+	v := reflect.Indirect(reflect.ValueOf(p))
+	if v.Kind() != reflect.Slice || v.Type() == reflect.TypeOf([]byte{}) {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
 func loadImpl(ctx context.Context, db DB, name string) (string, error) {
-	name = strings.TrimSuffix(name, ".sql")
-	q, _, err := findFile(db.(interface{ queryFiles() fs.FS }).queryFiles(), insertDriver(db, name)...)
+	name = zstring.TrimSuffixes(name, ".sql", ".gotxt")
+	zdb := Unwrap(db).(interface {
+		queryFiles() fs.FS
+		queryCache() *queryCache
+		templateData() interface{}
+	})
+	files, cache, paths := zdb.queryFiles(), zdb.queryCache(), insertDriver(db, name)
+	if q, ok := cache.get(files, name, paths); ok {
+		return q, nil
+	}
+
+	// Get the mtime before reading the file, so that a change between the
+	// stat and read will at worst cause an extra reload.
+	var mtime time.Time
+	if cache.reloads() {
+		_, mtime = statFirst(files, paths)
+	}
+
+	q, file, err := findFile(files, paths...)
 	if err != nil {
 		return "", fmt.Errorf("zdb.Load: %w", err)
 	}
+	if strings.HasSuffix(file, ".gotxt") {
+		q, err = queryTemplate(db.Driver(), file, q, zdb.templateData())
+		if err != nil {
+			return "", fmt.Errorf("zdb.Load: %w", err)
+		}
+	}
 
 	var b strings.Builder
 	b.WriteString("/* ")
@@ -335,6 +593,8 @@ func loadImpl(ctx context.Context, db DB, name string) (string, error) {
 			b.WriteRune('\n')
 		}
 	}
+
+	cache.set(name, file, b.String(), mtime)
 	return b.String(), nil
 }
 
@@ -365,6 +625,7 @@ func beginImpl(ctx context.Context, db DB, opts ...beginOpt) (context.Context, D
 	}
 
 	ztx := &zTX{db: tx, parent: Unwrap(db).(*zDB)}
+	ztx.stmts = newTxStmtCache(ztx.parent.stmts)
 	return WithDB(ctx, ztx), ztx, nil
 }
 
@@ -396,31 +657,57 @@ func txImpl(ctx context.Context, db DB, fn func(context.Context) error) error {
 }
 
 func execImpl(ctx context.Context, db DB, query string, params ...interface{}) error {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	if timeout, rest, ok := splitTimeout(params); ok {
+		return withTimeout(ctx, db, timeout, func(ctx context.Context, db DB) error {
+			return execImpl(ctx, db, query, rest...)
+		})
+	}
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
 		return err
 	}
+	ctx = withParamNames(ctx, pn)
 	_, err = db.(dbImpl).ExecContext(ctx, query, params...)
-	return err
+	return queryErr(query, params, err)
 }
 
 func numRowsImpl(ctx context.Context, db DB, query string, params ...interface{}) (int64, error) {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	if timeout, rest, ok := splitTimeout(params); ok {
+		var r int64
+		err := withTimeout(ctx, db, timeout, func(ctx context.Context, db DB) error {
+			var err error
+			r, err = numRowsImpl(ctx, db, query, rest...)
+			return err
+		})
+		return r, err
+	}
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
 		return 0, err
 	}
+	ctx = withParamNames(ctx, pn)
 	r, err := db.(dbImpl).ExecContext(ctx, query, params...)
 	if err != nil {
-		return 0, err
+		return 0, queryErr(query, params, err)
 	}
 	return r.RowsAffected()
 }
 
 func insertIDImpl(ctx context.Context, db DB, idColumn, query string, params ...interface{}) (int64, error) {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	if timeout, rest, ok := splitTimeout(params); ok {
+		var r int64
+		err := withTimeout(ctx, db, timeout, func(ctx context.Context, db DB) error {
+			var err error
+			r, err = insertIDImpl(ctx, db, idColumn, query, rest...)
+			return err
+		})
+		return r, err
+	}
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
 		return 0, err
 	}
+	ctx = withParamNames(ctx, pn)
 
 	// TODO: SQLite 3.35 (March 2021) also supports returning; probably better
 	// to use this for SQLite as well as it's more flexible. Need to make sure
@@ -431,14 +718,14 @@ func insertIDImpl(ctx context.Context, db DB, idColumn, query string, params ...
 		var id []int64
 		err := db.(dbImpl).SelectContext(ctx, &id, query+" returning "+idColumn, params...)
 		if err != nil {
-			return 0, err
+			return 0, queryErr(query, params, err)
 		}
 		return id[len(id)-1], nil
 	}
 
 	r, err := db.(dbImpl).ExecContext(ctx, query, params...)
 	if err != nil {
-		return 0, err
+		return 0, queryErr(query, params, err)
 	}
 	// TODO: On MariaDB lastinsertID returns the FIRST insert id, not the LAST.
 	// This is a MariaDB problem, not a Go problem.
@@ -475,37 +762,67 @@ func insertIDImpl(ctx context.Context, db DB, idColumn, query string, params ...
 }
 
 func selectImpl(ctx context.Context, db DB, dest interface{}, query string, params ...interface{}) error {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	if timeout, rest, ok := splitTimeout(params); ok {
+		return withTimeout(ctx, db, timeout, func(ctx context.Context, db DB) error {
+			return selectImpl(ctx, db, dest, query, rest...)
+		})
+	}
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
 		return err
 	}
-	return db.(dbImpl).SelectContext(ctx, dest, query, params...)
+	ctx = withParamNames(ctx, pn)
+	return queryErr(query, params, db.(dbImpl).SelectContext(ctx, dest, query, params...))
 }
 
 func getImpl(ctx context.Context, db DB, dest interface{}, query string, params ...interface{}) error {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	if timeout, rest, ok := splitTimeout(params); ok {
+		return withTimeout(ctx, db, timeout, func(ctx context.Context, db DB) error {
+			return getImpl(ctx, db, dest, query, rest...)
+		})
+	}
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
 		return err
 	}
-	return db.(dbImpl).GetContext(ctx, dest, query, params...)
+	ctx = withParamNames(ctx, pn)
+	return queryErr(query, params, db.(dbImpl).GetContext(ctx, dest, query, params...))
 }
 
 func queryImpl(ctx context.Context, db DB, query string, params ...interface{}) (*Rows, error) {
-	query, params, err := prepareImpl(ctx, db, query, params...)
+	// The rows are read after we return, so we can't use a transaction for
+	// statement_timeout here; just set the deadline, which is cancelled once
+	// the rows are closed.
+	var cancel context.CancelFunc
+	timeout, params, hasTimeout := splitTimeout(params)
+	if hasTimeout {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	query, params, pn, err := prepareNames(ctx, db, query, params...)
 	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
 		return nil, err
 	}
+	ctx = withParamNames(ctx, pn)
 	r, err := db.(dbImpl).QueryxContext(ctx, query, params...)
 	if err != nil {
+		err = queryErr(query, params, err)
+		if cancel != nil {
+			err = timeoutErr(ctx, timeout, err)
+			cancel()
+		}
 		return nil, err
 	}
-	return &Rows{r}, nil
+	return &Rows{r: r, cancel: cancel, tee: teeRows(ctx, db, query, params), count: countRows(db, query)}, nil
 }
 
 // Prepare the paramers:
 //
 //  - Multiple named parameters are merged in a single map.
-//  - DumpArgs are removed.
+//  - DumpArgs and Timeouts are removed.
 //  - Any io.Writer is removed.
 func prepareParams(params []interface{}) (interface{}, bool, DumpArg, io.Writer, error) {
 	if len(params) == 0 {
@@ -527,6 +844,9 @@ func prepareParams(params []interface{}) (interface{}, bool, DumpArg, io.Writer,
 			dumpArgs |= d
 			continue
 		}
+		if _, ok := param.(Timeout); ok {
+			continue
+		}
 		// TODO: maybe restrict this a bit more? What if you're passing a type
 		// which satisfies this interface?
 		if d, ok := param.(io.Writer); ok {
@@ -570,12 +890,24 @@ func prepareParams(params []interface{}) (interface{}, bool, DumpArg, io.Writer,
 			}
 
 			named = true
-			m := reflectx.NewMapperFunc("db", sqlx.NameMapper).FieldMap(reflect.ValueOf(param))
+			mapper := reflectx.NewMapperFunc("db", sqlx.NameMapper)
+			m := mapper.FieldMap(reflect.ValueOf(param))
+			fields := make(map[string]interface{}, len(m))
 			for k, v := range m {
 				if _, ok := mergedNamed[k]; ok {
 					return nil, false, 0, nil, fmt.Errorf("parameter given more than once: %q", k)
 				}
-				mergedNamed[k] = v.Interface()
+				fields[k] = v.Interface()
+			}
+			// db:",secret" has an empty name in sqlx.
+			for _, f := range secretFields(t, mapper) {
+				if f.fi.Name == "" {
+					delete(fields, f.fi.Path)
+					fields[f.name] = reflectx.FieldByIndexesReadOnly(reflect.Indirect(reflect.ValueOf(param)), f.fi.Index).Interface()
+				}
+			}
+			for k, v := range fields {
+				mergedNamed[k] = v
 			}
 		}
 	}
@@ -618,65 +950,206 @@ func isNamed(t reflect.Type, a interface{}) bool {
 	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
 }
 
-// TODO: it would be nice if this would deal with whitespace a bit better.
-//
-// This has two spaces:
+// Replace all {{:cond sql}} and {{:cond sql | else-sql}} conditionals.
 //
-//    where {{:x x = :x}} order by a → where  order by a
+// The condition is one or more parameter names, optionally negated with a !
+// suffix, and combined with && or || (&& binds stronger). Conditionals can be
+// nested.
 //
-// And with newlines it's even worse:
+// If a conditional is removed then the surrounding whitespace is collapsed, so
+// that "where {{:x x = :x}} order by" becomes "where order by", and a
+// conditional on its own line doesn't leave a blank line.
 //
-//    where
-//		{{:x x = :x}}
-//	  order by a
-//	  →
-//	  where
-//
-//	  order by a
-func replaceConditionals(query string, params ...interface{}) (string, error) {
-	for _, p := range zstring.IndexPairs(query, "{{:", "}}") {
-		s := p[0]
-		e := p[1]
-
-		name := query[s+3 : e]
-		i := strings.IndexAny(name, " \t\n")
-		if i == -1 {
+// Parameters that don't exist are treated as false, or an error if strict is
+// set.
+func replaceConditionals(query string, strict bool, params ...interface{}) (string, error) {
+	pos := 0
+	for {
+		s := strings.Index(query[pos:], "{{:")
+		if s == -1 {
+			return query, nil
+		}
+		s += pos
+		e := matchConditional(query, s)
+		if e == -1 {
+			return query, nil
+		}
+
+		cond, body, ok := splitConditional(query[s+3 : e])
+		if !ok {
+			pos = e + 2
 			continue
 		}
-		name = name[:i]
 
-		negate := strings.HasSuffix(name, "!")
-		if negate {
-			name = name[:len(name)-1]
+		include, err := evalConditional(cond, strict, params)
+		if err != nil {
+			return "", err
 		}
 
-		found := false
-		for _, param := range params {
-			// This is a bit inefficient, since it duplicates sqlx's NamedMapper
-			// logic; still seems plenty fast enough though.
-			include, has, err := includeConditional(param, name)
-			if err != nil {
-				return "", err
-			}
-			if !has {
-				continue
+		then, els := splitElse(body)
+		repl := els
+		if include {
+			repl = then
+		}
+		repl, err = replaceConditionals(repl, strict, params...)
+		if err != nil {
+			return "", err
+		}
+
+		if strings.TrimSpace(repl) != "" {
+			query = query[:s] + repl + query[e+2:]
+			pos = s + len(repl)
+			continue
+		}
+		query, pos = removeConditional(query, s, e+2)
+	}
+}
+
+// Find the "}}" belonging to the "{{:" at s, taking nested conditionals in to
+// account. Returns -1 if there is none.
+func matchConditional(query string, s int) int {
+	depth := 0
+	for i := s; i < len(query)-1; {
+		switch {
+		case strings.HasPrefix(query[i:], "{{:"):
+			depth++
+			i += 3
+		case strings.HasPrefix(query[i:], "}}"):
+			depth--
+			if depth == 0 {
+				return i
 			}
-			found = true
+			i += 2
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// Split "cond sql" in the condition and body. The condition can contain spaces
+// around && and ||.
+func splitConditional(block string) (string, string, bool) {
+	i := 0
+	for {
+		start := i
+		for i < len(block) && (isNameChar(block[i]) || block[i] == '!') {
+			i++
+		}
+		if i == start {
+			return "", "", false
+		}
+
+		j := i
+		for j < len(block) && (block[j] == ' ' || block[j] == '\t') {
+			j++
+		}
+		if !strings.HasPrefix(block[j:], "&&") && !strings.HasPrefix(block[j:], "||") {
+			break
+		}
+		i = j + 2
+		for i < len(block) && (block[i] == ' ' || block[i] == '\t') {
+			i++
+		}
+	}
+
+	if i >= len(block) || !strings.ContainsRune(" \t\n", rune(block[i])) {
+		return "", "", false
+	}
+	return block[:i], block[i+1:], true
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Split the body on a " | " that's not in a nested conditional.
+func splitElse(body string) (string, string) {
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case strings.HasPrefix(body[i:], "{{:"):
+			depth++
+			i += 2
+		case strings.HasPrefix(body[i:], "}}"):
+			depth--
+			i++
+		case depth == 0 && body[i] == '|' && i > 0 && i < len(body)-1 &&
+			strings.ContainsRune(" \t\n", rune(body[i-1])) && strings.ContainsRune(" \t\n", rune(body[i+1])):
+			return body[:i-1], body[i+2:]
+		}
+	}
+	return body, ""
+}
+
+// Evaluate the condition.
+func evalConditional(cond string, strict bool, params []interface{}) (include bool, err error) {
+	for _, or := range strings.Split(cond, "||") {
+		all := true
+		for _, name := range strings.Split(or, "&&") {
+			name = strings.TrimSpace(name)
+			negate := strings.HasSuffix(name, "!")
 			if negate {
-				include = !include
+				name = name[:len(name)-1]
 			}
-			if include {
-				query = query[:s] + query[s+i+4:]     // Everything except "{{:word"
-				query = query[:e-i-4] + query[e-i-2:] // Everything except "}}"
-			} else {
-				query = query[:s] + query[e+2:]
+
+			var inc, has bool
+			for _, param := range params {
+				// This is a bit inefficient, since it duplicates sqlx's
+				// NamedMapper logic; still seems plenty fast enough though.
+				inc, has, err = includeConditional(param, name)
+				if err != nil {
+					return false, err
+				}
+				if has {
+					break
+				}
 			}
-			if !found {
-				return "", fmt.Errorf("found not find %q for conditional", name)
+			if !has && strict {
+				return false, fmt.Errorf("could not find parameter %q for conditional", name)
 			}
+			if negate {
+				inc = !inc
+			}
+			all = all && inc
 		}
+		include = include || all
+	}
+	return include, nil
+}
+
+// Remove query[s:e] and collapse the surrounding whitespace. Returns the new
+// query and the position to continue from.
+func removeConditional(query string, s, e int) (string, int) {
+	lineStart := strings.LastIndexByte(query[:s], '\n') + 1
+	lineEnd := strings.IndexByte(query[e:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(query)
+	} else {
+		lineEnd += e
+	}
+
+	// Only thing on this line: remove the entire line.
+	if strings.TrimSpace(query[lineStart:s]) == "" && strings.TrimSpace(query[e:lineEnd]) == "" {
+		switch {
+		case lineEnd < len(query):
+			return query[:lineStart] + query[lineEnd+1:], lineStart
+		case lineStart > 0:
+			return query[:lineStart-1], lineStart - 1
+		default:
+			return "", 0
+		}
+	}
+
+	before := s > 0 && (query[s-1] == ' ' || query[s-1] == '\t')
+	after := e == len(query) || strings.ContainsRune(" \t\n", rune(query[e]))
+	switch {
+	case before && after:
+		s--
+	case !before && e < len(query) && (query[e] == ' ' || query[e] == '\t'):
+		e++
 	}
-	return query, nil
+	return query[:s] + query[e:], s
 }
 
 // TODO: we can simplify this a bit if we just always convert struct to map in
@@ -714,25 +1187,56 @@ func includeConditional(param interface{}, name string) (include, has bool, err
 	return false, false, nil
 }
 
+var (
+	truther = reflect.TypeOf((*Truther)(nil)).Elem()
+	zeroer  = reflect.TypeOf((*interface{ IsZero() bool })(nil)).Elem()
+	valuer  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// Check if a value is "true" for conditionals:
+//
+// - Truther is used if it's implemented.
+// - Types with IsZero() (such as time.Time) are true if they're not zero.
+// - driver.Valuer (such as sql.NullString) uses the result of Value().
+// - nil and nil pointers are false; other pointers use the pointed-to value.
+// - bool is as-is, signed numbers and floats are true if > 0, unsigned numbers
+//   if != 0, and strings, slices, arrays and maps if they're not empty.
 func isTruthy(name string, cond interface{}) (bool, error) {
-	switch c := cond.(type) {
-	case bool:
-		return c, nil
-	case string:
-		return len(c) > 0, nil
-	case int:
-		return c > 0, nil
-	case int64:
-		return c > 0, nil
-	case []string:
-		return len(c) > 0, nil
-	case []int:
-		return len(c) > 0, nil
-	case []int64:
-		return len(c) > 0, nil
-	case time.Time:
-		return !c.IsZero(), nil
+	if cond == nil {
+		return false, nil
+	}
+	v := reflect.ValueOf(cond)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return false, nil
+	}
+
+	switch t := v.Type(); {
+	case t.Implements(truther):
+		return cond.(Truther).IsTrue(), nil
+	case t.Implements(zeroer):
+		return !cond.(interface{ IsZero() bool }).IsZero(), nil
+	case t.Implements(valuer):
+		val, err := cond.(driver.Valuer).Value()
+		if err != nil {
+			return false, fmt.Errorf("conditional %q: %w", name, err)
+		}
+		return isTruthy(name, val)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		return isTruthy(name, v.Elem().Interface())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() > 0, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() != 0, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float() > 0, nil
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() > 0, nil
 	default:
-		return false, fmt.Errorf("unsupported conditional type %T for %q", c, name)
+		return false, fmt.Errorf("unsupported conditional type %T for %q", cond, name)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,6 +79,20 @@ func TestPrepare(t *testing.T) {
 		{`select :x, :y`, L{P{"x": "Y"}, struct{ Y int }{42}},
 			`select $1, $2`, L{"Y", 42}, ""},
 
+		// Casts, strings, and comments
+		{`select :x::int`, L{P{"x": "1"}},
+			`select $1::int`, L{"1"}, ""},
+		{`select ':x', ":x", :x -- :y`, L{P{"x": 1}},
+			`select ':x', ":x", $1 -- :y`, L{1}, ""},
+		{"select /* :y */ 'it''s :y', :x\n-- :y\n", L{P{"x": 1}},
+			"select /* :y */ 'it''s :y', $1\n-- :y\n", L{1}, ""},
+		{`select arr[1:2] from t where a = :x`, L{P{"x": 1}},
+			`select arr[1:2] from t where a = $1`, L{1}, ""},
+
+		// Missing named params
+		{`select :x, :y, :z`, L{P{"x": 1}},
+			``, nil, `missing parameters: "y", "z"`},
+
 		// One positional
 		{`select $1`, L{"A"},
 			`select $1`, L{"A"}, ""},
@@ -112,30 +127,68 @@ func TestPrepare(t *testing.T) {
 
 		// Negation with !
 		{`select {{:xxx! cond}} where 1=1`, L{P{"xxx": true}},
-			`select  where 1=1`, L{}, ""},
+			`select where 1=1`, L{}, ""},
 		// Negation with !
 		{`select {{:xxx! cond}} where 1=1`, L{P{"xxx": false}},
 			`select cond where 1=1`, L{}, ""},
 
 		// False conditional from bool
 		{`select {{:xxx cond}} where 1=1`, L{P{"xxx": false}},
-			`select  where 1=1`, L{}, ""},
+			`select where 1=1`, L{}, ""},
 		{`select {{:xxx cond}} where 1=1`, L{struct{ XXX bool }{false}},
-			`select  where 1=1`, L{}, ""},
+			`select where 1=1`, L{}, ""},
 		{`select {{:xxx cond}} where 1=1`, L{P{"a": false}, struct{ XXX bool }{false}},
-			`select  where 1=1`, L{}, ""},
+			`select where 1=1`, L{}, ""},
 
 		// Multiple conditionals
 		{`select {{:a cond}} {{:b cond2}} `, L{P{"a": true, "b": true}},
 			`select cond cond2 `, L{}, ""},
 		{`select {{:a cond}} {{:b cond2}} `, L{P{"a": false, "b": false}},
-			`select   `, L{}, ""},
+			`select `, L{}, ""},
 
 		// Parameters inside conditionals
 		{`select {{:a x like :foo}} {{:b y = :bar}}`, L{P{"foo": "qwe", "bar": "zxc", "a": true, "b": true}},
 			`select x like $1 y = $2`, L{"qwe", "zxc"}, ""},
 		{`select {{:a x like :foo}} {{:b y = :bar}}`, L{P{"foo": "qwe", "bar": "zxc", "a": false, "b": true}},
-			`select  y = $1`, L{"zxc"}, ""},
+			`select y = $1`, L{"zxc"}, ""},
+
+		// Else
+		{`select {{:a x | y}} from t`, L{P{"a": true}},
+			`select x from t`, L{}, ""},
+		{`select {{:a x | y}} from t`, L{P{"a": false}},
+			`select y from t`, L{}, ""},
+		{`select {{:a x || y | z}} from t`, L{P{"a": true}},
+			`select x || y from t`, L{}, ""},
+
+		// Nested
+		{`select {{:a x {{:b y}} | z {{:b! w}}}} from t`, L{P{"a": true, "b": true}},
+			`select x y from t`, L{}, ""},
+		{`select {{:a x {{:b y}} | z {{:b! w}}}} from t`, L{P{"a": true, "b": false}},
+			`select x from t`, L{}, ""},
+		{`select {{:a x {{:b y}} | z {{:b! w}}}} from t`, L{P{"a": false, "b": false}},
+			`select z w from t`, L{}, ""},
+
+		// && and ||
+		{`select {{:a && b x}} from t`, L{P{"a": true, "b": true}},
+			`select x from t`, L{}, ""},
+		{`select {{:a&&b x}} from t`, L{P{"a": true, "b": false}},
+			`select from t`, L{}, ""},
+		{`select {{:a || b x}} from t`, L{P{"a": false, "b": true}},
+			`select x from t`, L{}, ""},
+		{`select {{:a && b! || c x}} from t`, L{P{"a": true, "b": false, "c": false}},
+			`select x from t`, L{}, ""},
+		{`select {{:a && b! || c x}} from t`, L{P{"a": true, "b": true, "c": false}},
+			`select from t`, L{}, ""},
+
+		// Whitespace
+		{"select *\nwhere\n\t{{:a x = 1}}\n\t{{:b y = 1}}\norder by a", L{P{"a": false, "b": true}},
+			"select *\nwhere\n\ty = 1\norder by a", L{}, ""},
+		{"select *\nwhere\n\t{{:a x = 1}} {{:b y = 1}}\norder by a", L{P{"a": false, "b": false}},
+			"select *\nwhere\norder by a", L{}, ""},
+		{"select (\n\t{{:a x}})", L{P{"a": false}},
+			"select (\n\t)", L{}, ""},
+		{"select x\n{{:a y}}", L{P{"a": false}},
+			"select x", L{}, ""},
 
 		// Multiple conflicting params
 		{`select :x`, L{P{"x": 1}, P{"x": 2}},
@@ -147,9 +200,11 @@ func TestPrepare(t *testing.T) {
 		{`select :x`, L{P{"x": 1}, 42},
 			``, nil, "mix named and positional"},
 
-		// Conditional not found
+		// Conditional not found; treated as false.
 		{`select {{:x cond}}`, L{P{"z": 1}},
-			``, nil, "could not find"},
+			`select`, L{}, ""},
+		{`select {{:x! cond}}`, L{P{"z": 1}},
+			`select cond`, L{}, ""},
 
 		// Condtional with positional
 		{`select {{:x cond}}`, L{"z", 1},
@@ -188,6 +243,257 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestPrepareStrict(t *testing.T) {
+	ctx := StartTest(t, ConnectOptions{StrictConditionals: true})
+
+	_, _, err := Prepare(ctx, `select {{:x cond}}`, P{"z": 1})
+	if !ztest.ErrorContains(err, `could not find parameter "x"`) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	query, _, err := Prepare(ctx, `select {{:z cond}}`, P{"z": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "select cond" {
+		t.Errorf("wrong query: %q", query)
+	}
+}
+
+func TestPrepareStrictParams(t *testing.T) {
+	ctx := StartTest(t, ConnectOptions{StrictParams: true})
+
+	_, _, err := Prepare(ctx, `select :x`, P{"x": 1, "y": 2, "a": 3})
+	if !ztest.ErrorContains(err, `unused parameters: "a", "y"`) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// Used in conditional, and struct fields are never reported.
+	_, _, err = Prepare(ctx, `select :x {{:y && z! cond}}`,
+		P{"x": 1, "y": 2, "z": false}, struct{ A, B int }{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepareRepeated(t *testing.T) {
+	ctx := StartTest(t)
+
+	query, params, err := Prepare(ctx, `select :x, :y, :x, :z, :y`, P{"x": 1, "y": 2, "z": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := fmt.Sprintf("%s %v", query, params)
+	want := `select ?, ?, ?, ?, ? [1 2 1 3 2]`
+	if Driver(ctx) == DriverPostgreSQL {
+		want = `select $1, $2, $1, $3, $2 [1 2 3]`
+	}
+	if have != want {
+		t.Errorf("\nhave: %s\nwant: %s", have, want)
+	}
+
+	var n int
+	err = Get(ctx, &n, `select :x + :x`, P{"x": 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("n = %d", n)
+	}
+}
+
+func TestPrepareLiteral(t *testing.T) {
+	ctx := StartTest(t)
+
+	q := func(s string) string {
+		if Driver(ctx) == DriverMariaDB {
+			return strings.ReplaceAll(s, `"`, "`")
+		}
+		return s
+	}
+
+	// ? in string literals and comments isn't a placeholder.
+	tests := []struct {
+		query      string
+		params     []interface{}
+		want       string
+		wantPG     string
+		wantParams []interface{}
+	}{
+		{`select '?', ? /* ? */, ?`, L{SQL("1"), 2},
+			`select '?', 1 /* ? */, ?`, `select '?', 1 /* ? */, $1`, L{2}},
+		{`select '?' from ? where a = ?`, L{Ident("x"), 1},
+			q(`select '?' from "x" where a = ?`), `select '?' from "x" where a = $1`, L{1}},
+		{`select '?' where a in (?) and b = ?`, L{[]int{1, 2}, 3},
+			`select '?' where a in (1, 2) and b = ?`, `select '?' where a in (1, 2) and b = $1`, L{3}},
+		{`select '?' where a in (?) and b = ?`, L{[]string{"a", "b"}, 3},
+			`select '?' where a in (?, ?) and b = ?`, `select '?' where a in ($1, $2) and b = $3`, L{"a", "b", 3}},
+		{`select '?', :a, '?', :b, :a`, L{P{"a": 1, "b": SQL("2")}},
+			`select '?', ?, '?', 2, ?`, `select '?', $1, '?', 2, $1`, L{1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			query, params, err := Prepare(ctx, tt.query, tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if Driver(ctx) == DriverPostgreSQL {
+				want = tt.wantPG
+				if strings.Contains(tt.query, ":a") {
+					tt.wantParams = L{1} // Repeated named parameters are sent once.
+				}
+			}
+			if query != want {
+				t.Errorf("wrong query\nhave: %s\nwant: %s", query, want)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("wrong params\nhave: %#v\nwant: %#v", params, tt.wantParams)
+			}
+		})
+	}
+
+	err := Exec(ctx, `create table x (i int, s varchar(10)); insert into x values (1, '?'), (2, 'a')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []int
+	err = Select(ctx, &have, `select i from x where s <> '?' and i in (?) and s = ?`, []int{1, 2}, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, []int{2}) {
+		t.Errorf("wrong result: %v", have)
+	}
+}
+
+func TestPrepareIdent(t *testing.T) {
+	ctx := StartTest(t)
+
+	q := func(s string) string {
+		if Driver(ctx) == DriverMariaDB {
+			return strings.ReplaceAll(s, `"`, "`")
+		}
+		return s
+	}
+
+	tests := []struct {
+		query   string
+		params  []interface{}
+		want    string
+		wantErr string
+	}{
+		{`select * from :tbl order by :col`, L{P{"tbl": Ident("x"), "col": Ident("a")}},
+			q(`select * from "x" order by "a"`), ""},
+		{`select * from ? where ? = ?`, L{Ident("s", "x"), Ident("a"), 1},
+			q(`select * from "s"."x" where "a" = ?`), ""},
+		{`select * from :tbl`, L{P{"tbl": Ident(`x"y`)}},
+			`select * from "x""y"`, ""},
+		{`select * from :tbl`, L{P{"tbl": Ident()}},
+			``, "no identifier"},
+		{`select * from :tbl`, L{P{"tbl": Ident("s", "")}},
+			``, "empty identifier"},
+		{`select * from :tbl`, L{P{"tbl": Ident("a\x00")}},
+			``, "NUL byte"},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			if Driver(ctx) == DriverMariaDB && strings.Contains(tt.want, `""`) {
+				t.Skip()
+			}
+			query, _, err := Prepare(ctx, tt.query, tt.params...)
+			if !ztest.ErrorContains(err, tt.wantErr) {
+				t.Fatal(err)
+			}
+			if query = sqlx.Rebind(sqlx.QUESTION, query); query != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", query, tt.want)
+			}
+		})
+	}
+
+	t.Run("query", func(t *testing.T) {
+		err := Exec(ctx, `create table t (a int, b int); insert into t values (1, 2), (2, 1);`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, col := range []string{"a", "b"} {
+			var have []int
+			err := Select(ctx, &have, `select a from t order by :col`, P{"col": Ident(col)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"a": "[1 2]", "b": "[2 1]"}[col]
+			if fmt.Sprintf("%v", have) != want {
+				t.Errorf("%s: %v", col, have)
+			}
+		}
+	})
+}
+
+type testTruther bool
+
+func (t testTruther) IsTrue() bool { return bool(t) }
+
+type id uint64
+
+func TestIsTruthy(t *testing.T) {
+	var (
+		s  = "x"
+		es = ""
+		np *string
+	)
+	tests := []struct {
+		in      interface{}
+		want    bool
+		wantErr string
+	}{
+		{nil, false, ""},
+		{true, true, ""},
+		{false, false, ""},
+		{"x", true, ""},
+		{"", false, ""},
+		{1, true, ""},
+		{0, false, ""},
+		{-1, false, ""},
+		{uint(1), true, ""},
+		{uint8(0), false, ""},
+		{id(5), true, ""},
+		{id(0), false, ""},
+		{1.5, true, ""},
+		{float32(0), false, ""},
+		{&s, true, ""},
+		{&es, false, ""},
+		{np, false, ""},
+		{[]string{"a"}, true, ""},
+		{[]uint64{}, false, ""},
+		{[]id{1}, true, ""},
+		{map[string]int{}, false, ""},
+		{time.Time{}, false, ""},
+		{time.Now(), true, ""},
+		{sql.NullString{}, false, ""},
+		{sql.NullString{Valid: true, String: "x"}, true, ""},
+		{sql.NullInt64{Valid: true}, false, ""},
+		{sql.NullBool{Valid: true, Bool: true}, true, ""},
+		{testTruther(true), true, ""},
+		{testTruther(false), false, ""},
+		{struct{}{}, false, "unsupported conditional type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%T %v", tt.in, tt.in), func(t *testing.T) {
+			have, err := isTruthy("x", tt.in)
+			if !ztest.ErrorContains(err, tt.wantErr) {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("have: %t; want: %t", have, tt.want)
+			}
+		})
+	}
+}
+
 func TestPrepareDump(t *testing.T) {
 	ctx := StartTest(t)
 
@@ -474,6 +780,17 @@ func TestLoad(t *testing.T) {
 			}
 		}
 	}
+
+	{
+		got, err := Load(ctx, "tpl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "/* tpl */\nselect * from t where col like :find {{:x and 1=1}}\n"
+		if got != want {
+			t.Errorf("\ngot:  %q\nwant: %q", got, want)
+		}
+	}
 }
 
 func TestBegin(t *testing.T) {
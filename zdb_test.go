@@ -1,10 +1,12 @@
 package zdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +18,27 @@ var (
 	_ DB = zTX{}
 )
 
+// startWrapTest starts a test with a table x containing the integers 1 to n.
+func startWrapTest(t *testing.T, n int) context.Context {
+	t.Helper()
+	ctx := StartTest(t)
+
+	vals := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		vals = append(vals, fmt.Sprintf("(%d)", i))
+	}
+	err := Exec(ctx, `create table x (i int); insert into x values `+strings.Join(vals, ", "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// wrapDB gets a context with the unwrapped DB from ctx wrapped by wrap.
+func wrapDB(ctx context.Context, wrap func(DB) DB) context.Context {
+	return WithDB(context.Background(), wrap(Unwrap(MustGetDB(ctx))))
+}
+
 func TestUnwrap(t *testing.T) {
 	ctx := StartTest(t)
 